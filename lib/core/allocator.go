@@ -0,0 +1,93 @@
+package core
+
+import "sync"
+
+// allocator hands out generational entity ids for a single world. An id packs
+// the slot index in its low 32 bits and the slot generation in its high 32
+// bits; a slot's generation is bumped whenever it is released so that stale
+// handles to the slot can be told apart from the live entity.
+type allocator struct {
+	mu    sync.Mutex
+	gens  []uint32
+	alive []bool
+	free  []uint32
+	live  int
+	dirty bool // changed since the last rollback frame
+}
+
+func newAllocator() *allocator {
+	return &allocator{dirty: true}
+}
+
+func pack(index, gen uint32) uint64 {
+	return uint64(gen)<<32 | uint64(index)
+}
+
+func unpack(id uint64) (uint32, uint32) {
+	return uint32(id), uint32(id >> 32)
+}
+
+func (a *allocator) next() uint64 {
+	var index uint32
+	if n := len(a.free); n > 0 {
+		index = a.free[n-1]
+		a.free = a.free[:n-1]
+	} else {
+		index = uint32(len(a.gens))
+		a.gens = append(a.gens, 1)
+		a.alive = append(a.alive, false)
+	}
+	a.alive[index] = true
+	a.live++
+	a.dirty = true
+	return pack(index, a.gens[index])
+}
+
+func (a *allocator) allocate() uint64 {
+	a.mu.Lock()
+	id := a.next()
+	a.mu.Unlock()
+	return id
+}
+
+func (a *allocator) allocateN(n int) []uint64 {
+	ret := make([]uint64, n)
+	a.mu.Lock()
+	for i := range ret {
+		ret[i] = a.next()
+	}
+	a.mu.Unlock()
+	return ret
+}
+
+func (a *allocator) isAlive(id uint64) bool {
+	index, gen := unpack(id)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(index) < len(a.gens) && a.alive[index] && a.gens[index] == gen
+}
+
+// release frees the slot of a live id, returning false for stale ids.
+func (a *allocator) release(id uint64) bool {
+	index, gen := unpack(id)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if int(index) >= len(a.gens) || !a.alive[index] || a.gens[index] != gen {
+		return false
+	}
+	a.alive[index] = false
+	a.gens[index]++
+	if a.gens[index] == 0 {
+		a.gens[index] = 1
+	}
+	a.free = append(a.free, index)
+	a.live--
+	a.dirty = true
+	return true
+}
+
+func (a *allocator) len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.live
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// Tracker is implemented by systems filtering queries by change. Before every
+// Update the system is handed the change tick at the start of its previous
+// run, 0 before its first run, to be passed to Query.Since so that the system
+// sees every change made since it last ran, including its own.
+type Tracker interface {
+	SetLastRun(uint64)
+}
+
+func (w *world) nextTick() uint64 {
+	return atomic.AddUint64(&w.change, 1)
+}
+
+// ChangeTick returns the current change tick of the world. Every attach or
+// marked change advances the tick, stamping the components involved.
+func (w *world) ChangeTick() uint64 {
+	return atomic.LoadUint64(&w.change)
+}
+
+// MarkChanged stamps the components of the entity sharing the types of those
+// provided with a new change tick, for pointer components modified in place
+// rather than attached again.
+func (w *world) MarkChanged(e Entity, c ...Component) {
+	id := e.ID()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tick := w.nextTick()
+	for _, cmp := range c {
+		if s := w.cmp.store(typeOf(cmp)); s != nil && s.touch(id, tick) {
+			cur, _ := s.get(id)
+			w.emit(OnComponentChange, ComponentEvent{e, cur, cur})
+		}
+	}
+}
+
+// Added restricts the query to entities holding components of every provided
+// type, each attached after the tick the query is compared against.
+func (q *Query) Added(c ...Component) *Query {
+	q.With(c...)
+	for _, cmp := range c {
+		q.added = append(q.added, typeOf(cmp))
+	}
+	return q
+}
+
+// Changed restricts the query to entities holding components of every
+// provided type, each attached or marked changed after the tick the query is
+// compared against.
+func (q *Query) Changed(c ...Component) *Query {
+	q.With(c...)
+	for _, cmp := range c {
+		q.changed = append(q.changed, typeOf(cmp))
+	}
+	return q
+}
+
+// Since sets the change tick Added and Changed filters are compared against,
+// typically the last run tick handed to a Tracker. By default filters compare
+// against the start of the current or latest world update.
+func (q *Query) Since(tick uint64) *Query {
+	q.since = &tick
+	return q
+}
+
+// ids returns the matching set of the query, filtered by change. The world
+// must be read locked.
+func (q *Query) ids(c *cached) []uint64 {
+	if len(q.added) == 0 && len(q.changed) == 0 {
+		return c.ids
+	}
+	since := atomic.LoadUint64(&q.w.frame)
+	if q.since != nil {
+		since = *q.since
+	}
+	added, changed := q.stores(q.added), q.stores(q.changed)
+	var ret []uint64
+	for _, id := range c.ids {
+		if after(added, id, since, func(s *store) []uint64 { return s.added }) &&
+			after(changed, id, since, func(s *store) []uint64 { return s.changed }) {
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
+
+func (q *Query) stores(ts []reflect.Type) []*store {
+	ret := make([]*store, len(ts))
+	for i, t := range ts {
+		ret[i] = q.w.cmp.store(t)
+	}
+	return ret
+}
+
+// after reports whether the entity's components in every store carry a tick
+// later than since.
+func after(stores []*store, id, since uint64, ticks func(*store) []uint64) bool {
+	for _, s := range stores {
+		i, ok := s.index[id]
+		if !ok || ticks(s)[i] <= since {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package core
+
+import "sync"
+
+// chanSub delivers events over a channel. Sends happen under mu so that the
+// channel is never closed while sending; done unblocks a sender waiting on a
+// full channel once cancelled.
+type chanSub struct {
+	mu     sync.Mutex
+	ch     chan Event
+	done   chan struct{}
+	closed bool
+	policy Overflow
+	once   sync.Once
+}
+
+func (c *chanSub) deliver(ev *Event) {
+	e := Event{Name: ev.Name, Data: ev.Data}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	switch c.policy {
+	case Block:
+		select {
+		case c.ch <- e:
+		case <-c.done:
+		}
+	case DropOldest:
+		for {
+			select {
+			case c.ch <- e:
+				return
+			case <-c.done:
+				return
+			default:
+			}
+			select {
+			case <-c.ch:
+			case <-c.done:
+				return
+			default:
+			}
+		}
+	default:
+		select {
+		case c.ch <- e:
+		default:
+		}
+	}
+}
+
+func (c *chanSub) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		c.closed = true
+		close(c.ch)
+		c.mu.Unlock()
+	})
+}
+
+// SubscribeChan subscribes a channel of the provided buffer size to events
+// with the given name or pattern, for consumers running on their own
+// goroutine. When the channel is full the policy applies: Block waits for the
+// consumer, holding up the dispatch, DropNewest discards the event and
+// DropOldest discards the oldest buffered event. Events are delivered as
+// copies, cancelling them has no effect. The drop policies need room to
+// buffer an event, a buffer below 1 is raised to 1 for them. The returned function unsubscribes
+// and closes the channel, and may be called more than once.
+func (d *Dsptchr) SubscribeChan(evname string, buffer int, policy Overflow) (<-chan Event, func()) {
+	if policy != Block && buffer < 1 {
+		buffer = 1
+	}
+	c := &chanSub{
+		ch:     make(chan Event, buffer),
+		done:   make(chan struct{}),
+		policy: policy,
+	}
+	sub := d.SubscribeWith(evname, SubscribeOptions{}, c.deliver)
+	return c.ch, func() {
+		sub.Unsubscribe()
+		c.close()
+	}
+}
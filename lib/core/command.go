@@ -0,0 +1,87 @@
+package core
+
+import "sync"
+
+// Commander is implemented by systems queueing structural changes rather than
+// applying them while other systems may be iterating. Before every Update the
+// system is handed its own command buffer, which is applied once every system
+// of the stage has run.
+type Commander interface {
+	SetCommands(*Commands)
+}
+
+type command func(*world)
+
+// Commands is a buffer of structural world changes, applied in the order they
+// were queued at the next sync point: the end of the running stage, or the end
+// of the next stage for buffers used outside a world update.
+type Commands struct {
+	w   *world
+	mu  sync.Mutex
+	ops []command
+}
+
+func newCommands(w *world) *Commands {
+	return &Commands{w: w}
+}
+
+func (c *Commands) push(cmd command) {
+	c.mu.Lock()
+	c.ops = append(c.ops, cmd)
+	c.mu.Unlock()
+}
+
+// Spawn allocates an entity immediately and queues attaching the provided
+// components. The entity is alive but holds no components until applied.
+func (c *Commands) Spawn(cs ...Component) Entity {
+	e := c.w.NewEntity()
+	if len(cs) > 0 {
+		c.push(func(w *world) { w.Attach(e, cs...) })
+	}
+	return e
+}
+
+// Despawn queues despawning the entity.
+func (c *Commands) Despawn(e Entity) {
+	c.push(func(w *world) { w.Despawn(e) })
+}
+
+// Attach queues attaching components to the entity.
+func (c *Commands) Attach(e Entity, cs ...Component) {
+	c.push(func(w *world) { w.Attach(e, cs...) })
+}
+
+// Detach queues detaching components of the provided types from the entity.
+func (c *Commands) Detach(e Entity, cs ...Component) {
+	c.push(func(w *world) { w.Detach(e, cs...) })
+}
+
+// Len returns the number of queued commands.
+func (c *Commands) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.ops)
+}
+
+// apply runs and clears every queued command, including commands queued while
+// applying.
+func (c *Commands) apply() {
+	for {
+		c.mu.Lock()
+		ops := c.ops
+		c.ops = nil
+		c.mu.Unlock()
+		if len(ops) == 0 {
+			return
+		}
+		for _, cmd := range ops {
+			cmd(c.w)
+		}
+	}
+}
+
+// Commands returns the world command buffer, for queueing structural changes
+// from outside of a system.
+func (w *world) Commands() *Commands {
+	return w.cmds
+}
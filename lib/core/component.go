@@ -0,0 +1,225 @@
+package core
+
+import "reflect"
+
+// Component is any value attached to an entity. Components are keyed by their
+// concrete type, an entity holds at most one component of each type.
+type Component interface{}
+
+// typeOf returns the storage key for the provided component. A nil pointer of
+// the component type, e.g. (*Position)(nil), may be used where only the type
+// is of interest.
+func typeOf(c Component) reflect.Type {
+	return reflect.TypeOf(c)
+}
+
+// mask is a bitset of component store ids.
+type mask []uint64
+
+func (m mask) has(bit uint) bool {
+	i := bit / 64
+	if int(i) >= len(m) {
+		return false
+	}
+	return m[i]&(1<<(bit%64)) != 0
+}
+
+func (m mask) set(bit uint) mask {
+	i := int(bit / 64)
+	for len(m) <= i {
+		m = append(m, 0)
+	}
+	m[i] |= 1 << (bit % 64)
+	return m
+}
+
+func (m mask) unset(bit uint) mask {
+	i := int(bit / 64)
+	if i < len(m) {
+		m[i] &^= 1 << (bit % 64)
+	}
+	return m
+}
+
+func (m mask) empty() bool {
+	for _, v := range m {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// store is a densely packed set of components of a single type, along with
+// the change ticks at which each component was added and last changed.
+type store struct {
+	typ     reflect.Type
+	bit     uint
+	index   map[uint64]int
+	ids     []uint64
+	data    []Component
+	added   []uint64
+	changed []uint64
+	dirty   bool // changed since the last rollback frame
+}
+
+func newStore(t reflect.Type, bit uint) *store {
+	return &store{
+		typ:   t,
+		bit:   bit,
+		index: make(map[uint64]int),
+		dirty: true,
+	}
+}
+
+func (s *store) get(id uint64) (Component, bool) {
+	if i, ok := s.index[id]; ok {
+		return s.data[i], true
+	}
+	return nil, false
+}
+
+// set returns true if the component was newly added rather than replaced.
+func (s *store) set(id uint64, c Component, tick uint64) bool {
+	s.dirty = true
+	if i, ok := s.index[id]; ok {
+		s.data[i] = c
+		s.changed[i] = tick
+		return false
+	}
+	s.index[id] = len(s.ids)
+	s.ids = append(s.ids, id)
+	s.data = append(s.data, c)
+	s.added = append(s.added, tick)
+	s.changed = append(s.changed, tick)
+	return true
+}
+
+// touch sets the change tick of the component held by the entity.
+func (s *store) touch(id uint64, tick uint64) bool {
+	i, ok := s.index[id]
+	if ok {
+		s.dirty = true
+		s.changed[i] = tick
+	}
+	return ok
+}
+
+func (s *store) remove(id uint64) (Component, bool) {
+	i, ok := s.index[id]
+	if !ok {
+		return nil, false
+	}
+	s.dirty = true
+	c := s.data[i]
+	last := len(s.ids) - 1
+	if i != last {
+		s.ids[i] = s.ids[last]
+		s.data[i] = s.data[last]
+		s.added[i] = s.added[last]
+		s.changed[i] = s.changed[last]
+		s.index[s.ids[i]] = i
+	}
+	s.ids = s.ids[:last]
+	s.data[last] = nil
+	s.data = s.data[:last]
+	s.added = s.added[:last]
+	s.changed = s.changed[:last]
+	delete(s.index, id)
+	return c, true
+}
+
+func (s *store) len() int {
+	return len(s.ids)
+}
+
+// components holds every component store of a world along with the set of
+// component types attached to each entity.
+type components struct {
+	stores   map[reflect.Type]*store
+	byBit    []*store
+	entities map[uint64]mask
+}
+
+func newComponents() *components {
+	return &components{
+		stores:   make(map[reflect.Type]*store),
+		entities: make(map[uint64]mask),
+	}
+}
+
+func (c *components) store(t reflect.Type) *store {
+	return c.stores[t]
+}
+
+func (c *components) storeFor(t reflect.Type) *store {
+	s, ok := c.stores[t]
+	if !ok {
+		s = newStore(t, uint(len(c.byBit)))
+		c.stores[t] = s
+		c.byBit = append(c.byBit, s)
+	}
+	return s
+}
+
+func (c *components) attach(id uint64, cmp Component, tick uint64) (*store, bool) {
+	s := c.storeFor(typeOf(cmp))
+	added := s.set(id, cmp, tick)
+	if added {
+		c.entities[id] = c.entities[id].set(s.bit)
+	}
+	return s, added
+}
+
+func (c *components) detach(id uint64, t reflect.Type) (*store, Component, bool) {
+	s := c.store(t)
+	if s == nil {
+		return nil, nil, false
+	}
+	cmp, ok := s.remove(id)
+	if ok {
+		m := c.entities[id].unset(s.bit)
+		if m.empty() {
+			delete(c.entities, id)
+		} else {
+			c.entities[id] = m
+		}
+	}
+	return s, cmp, ok
+}
+
+func (c *components) get(id uint64, t reflect.Type) (Component, bool) {
+	if s := c.store(t); s != nil {
+		return s.get(id)
+	}
+	return nil, false
+}
+
+func (c *components) all(id uint64) []Component {
+	m := c.entities[id]
+	var ret []Component
+	for _, s := range c.byBit {
+		if m.has(s.bit) {
+			cmp, _ := s.get(id)
+			ret = append(ret, cmp)
+		}
+	}
+	return ret
+}
+
+// clear removes every component of the entity, returning the stores touched.
+func (c *components) clear(id uint64) []*store {
+	m, ok := c.entities[id]
+	if !ok {
+		return nil
+	}
+	var touched []*store
+	for _, s := range c.byBit {
+		if m.has(s.bit) {
+			s.remove(id)
+			touched = append(touched, s)
+		}
+	}
+	delete(c.entities, id)
+	return touched
+}
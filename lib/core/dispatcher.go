@@ -1,24 +1,225 @@
 package core
 
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
 type Dispatcher interface {
-	Subscribe(string, Callback)
-	SubscribeID(string, interface{}, Callback)
+	Subscribe(string, Callback) *Subscription
+	SubscribeID(string, interface{}, Callback) *Subscription
+	SubscribeEvent(string, interface{}, Handler) *Subscription
+	SubscribeOnce(string, Callback) *Subscription
+	SubscribePriority(string, int, Callback) *Subscription
+	SubscribeWith(string, SubscribeOptions, Handler) *Subscription
+	SubscribeChan(string, int, Overflow) (<-chan Event, func())
 	UnsubscribeID(string, interface{}) int
 	Dispatch(string, interface{}) bool
 	ClearSubscriptions()
 	CancelDispatch()
+	Enqueue(string, interface{}) bool
+	Flush() int
+	SetQueueLimit(int, Overflow)
+	Queued() (int, int)
+	Use(...Middleware)
 }
 
+// Dsptchr is a Dispatcher safe for concurrent use. Subscriptions are copied on
+// write: a dispatch calls the subscribers present when it started, changes
+// made while dispatching apply from the next dispatch on.
+//
+// Event names are dot separated, e.g. "net.peer.join". A subscription name may
+// be a pattern where a "*" segment matches any single segment and a "**"
+// segment matches any number of segments, including none: "entity.*" matches
+// "entity.spawn" and "net.**" matches "net", "net.peer" and "net.peer.join".
+// Subscribers are called by descending priority, then in the order they
+// subscribed, whether by name or by pattern.
 type Dsptchr struct {
-	evmap  map[string][]subscription // maps event name to subcriptions list
-	cancel bool                      // flag informing cancelled dispatch
+	mu       sync.Mutex   // serializes subscription changes
+	evmap    atomic.Value // *subscriptions, never modified once stored
+	seq      uint64       // orders subscriptions, guarded by mu
+	inflight sync.Map     // *Event currently dispatching, for CancelDispatch
+	mw       atomic.Value // []Middleware, never modified once stored
+	qonce    sync.Once
+	queue    *queue
 }
 
 type Callback func(string, interface{})
 
+// Event is a single dispatch of an event, handed to Handler subscribers.
+type Event struct {
+	Name      string
+	Data      interface{}
+	cancelled int32
+}
+
+// Cancel stops this dispatch of the event, no more subscribers are called.
+// Other dispatches, including concurrent dispatches of the same event name,
+// are unaffected.
+func (e *Event) Cancel() {
+	atomic.StoreInt32(&e.cancelled, 1)
+}
+
+// Cancelled returns true if the dispatch was cancelled.
+func (e *Event) Cancelled() bool {
+	return atomic.LoadInt32(&e.cancelled) == 1
+}
+
+// Handler receives events through SubscribeEvent.
+type Handler func(*Event)
+
 type subscription struct {
-	id interface{}
-	cb func(string, interface{})
+	name     string // the name or pattern subscribed to
+	id       interface{}
+	hasID    bool
+	h        Handler
+	seq      uint64
+	priority int
+	once     *int32 // set once a once-only subscription fired
+}
+
+// before orders subscriptions by descending priority, then subscription order.
+func (s subscription) before(o subscription) bool {
+	if s.priority != o.priority {
+		return s.priority > o.priority
+	}
+	return s.seq < o.seq
+}
+
+// is reports whether the subscription carries the id. Ids of types that cannot
+// be compared never match.
+func (s subscription) is(id interface{}) bool {
+	if !s.hasID {
+		return false
+	}
+	if s.id == nil || id == nil {
+		return s.id == id
+	}
+	t := reflect.TypeOf(s.id)
+	return t == reflect.TypeOf(id) && t.Comparable() && s.id == id
+}
+
+// SubscribeOptions configures a subscription made with SubscribeWith.
+type SubscribeOptions struct {
+	// ID, when HasID is set, allows unsubscribing with UnsubscribeID.
+	ID    interface{}
+	HasID bool
+	// Priority orders subscribers, higher priorities are called first.
+	Priority int
+	// Once unsubscribes the subscriber after the first event it receives.
+	Once bool
+}
+
+// Subscription is the handle of a single subscription.
+type Subscription struct {
+	d      *Dsptchr
+	evname string
+	seq    uint64
+}
+
+// Unsubscribe removes the subscription, returning false if it was already
+// removed.
+func (s *Subscription) Unsubscribe() bool {
+	return s.d.unsubscribe(s.evname, s.seq)
+}
+
+// subscriptions holds exact subscriptions by event name and pattern
+// subscriptions by pattern, along with a trie of the patterns and a cache of
+// the subscribers matching each dispatched event name.
+type subscriptions struct {
+	exact    map[string][]subscription
+	patterns map[string][]subscription
+	trie     *node
+	matched  sync.Map // event name to []subscription
+}
+
+// newSubscriptions builds the trie of the patterns unless provided.
+func newSubscriptions(exact, patterns map[string][]subscription, trie *node) *subscriptions {
+	s := &subscriptions{exact: exact, patterns: patterns, trie: trie}
+	if trie == nil {
+		s.trie = newNode()
+		for p, subs := range patterns {
+			s.trie.insert(strings.Split(p, "."), subs)
+		}
+	}
+	return s
+}
+
+// match returns the subscribers of the event name in the order they are
+// called.
+func (s *subscriptions) match(evname string) []subscription {
+	if len(s.patterns) == 0 {
+		return s.exact[evname]
+	}
+	if m, ok := s.matched.Load(evname); ok {
+		return m.([]subscription)
+	}
+	found := s.trie.match(strings.Split(evname, "."), nil)
+	found = append(found, s.exact[evname]...)
+	sort.Slice(found, func(i, j int) bool { return found[i].before(found[j]) })
+	ret := found[:0]
+	seen := make(map[uint64]bool, len(found))
+	for _, sub := range found {
+		if !seen[sub.seq] {
+			seen[sub.seq] = true
+			ret = append(ret, sub)
+		}
+	}
+	s.matched.Store(evname, ret)
+	return ret
+}
+
+// node is a trie of pattern segments.
+type node struct {
+	children map[string]*node
+	subs     []subscription
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+func (n *node) insert(segs []string, subs []subscription) {
+	for _, seg := range segs {
+		c, ok := n.children[seg]
+		if !ok {
+			c = newNode()
+			n.children[seg] = c
+		}
+		n = c
+	}
+	n.subs = append(n.subs, subs...)
+}
+
+func (n *node) match(segs []string, out []subscription) []subscription {
+	if len(segs) == 0 {
+		out = append(out, n.subs...)
+	} else {
+		if c, ok := n.children[segs[0]]; ok {
+			out = c.match(segs[1:], out)
+		}
+		if c, ok := n.children["*"]; ok {
+			out = c.match(segs[1:], out)
+		}
+	}
+	if c, ok := n.children["**"]; ok {
+		for i := 0; i <= len(segs); i++ {
+			out = c.match(segs[i:], out)
+		}
+	}
+	return out
+}
+
+func isPattern(evname string) bool {
+	for _, seg := range strings.Split(evname, ".") {
+		if seg == "*" || seg == "**" {
+			return true
+		}
+	}
+	return false
 }
 
 // NewEventDispatcher creates and returns a pointer to an Event Dispatcher
@@ -31,77 +232,198 @@ func NewDispatcher() *Dsptchr {
 // Initialize initializes this event dispatcher.
 // It is normally used by other types which embed an event dispatcher
 func (d *Dsptchr) Initialize() {
-	d.evmap = make(map[string][]subscription)
+	d.evmap.Store(newSubscriptions(make(map[string][]subscription), make(map[string][]subscription), nil))
 }
 
-// Subscribe subscribes to receive events with the given name.
-// If it is necessary to unsubscribe the event, the function SubscribeID
-// should be used.
-func (d *Dsptchr) Subscribe(evname string, cb Callback) {
-	d.SubscribeID(evname, nil, cb)
+func (d *Dsptchr) load() *subscriptions {
+	if s, ok := d.evmap.Load().(*subscriptions); ok {
+		return s
+	}
+	return newSubscriptions(nil, nil, nil)
+}
+
+// current returns the subscriptions to the event name or pattern.
+func (s *subscriptions) current(evname string) []subscription {
+	if isPattern(evname) {
+		return s.patterns[evname]
+	}
+	return s.exact[evname]
+}
+
+// update replaces the subscriptions of the event name or pattern with those
+// returned by fn, which must not modify the slice it is handed. d.mu must be
+// held.
+func (d *Dsptchr) update(evname string, fn func([]subscription) []subscription) {
+	old := d.load()
+	exact, patterns, trie := old.exact, old.patterns, old.trie
+	from := &exact
+	if isPattern(evname) {
+		from, trie = &patterns, nil
+	}
+	m := make(map[string][]subscription, len(*from)+1)
+	for k, v := range *from {
+		m[k] = v
+	}
+	if subs := fn(m[evname]); len(subs) > 0 {
+		m[evname] = subs
+	} else {
+		delete(m, evname)
+	}
+	*from = m
+	d.evmap.Store(newSubscriptions(exact, patterns, trie))
+}
+
+// Subscribe subscribes to receive events with the given name or pattern.
+// The returned handle unsubscribes exactly this subscription.
+func (d *Dsptchr) Subscribe(evname string, cb Callback) *Subscription {
+	return d.SubscribeWith(evname, SubscribeOptions{}, callback(cb))
 }
 
 // Subscribe subscribes to receive events with the given name.
 // The function accepts a unique id to be use to unsubscribe this event
-func (d *Dsptchr) SubscribeID(evname string, id interface{}, cb Callback) {
-	d.evmap[evname] = append(d.evmap[evname], subscription{id, cb})
+func (d *Dsptchr) SubscribeID(evname string, id interface{}, cb Callback) *Subscription {
+	return d.SubscribeWith(evname, SubscribeOptions{ID: id, HasID: true}, callback(cb))
 }
 
-// Unsubscribe unsubscribes from the specified event and subscription id
-// Returns the number of subscriptions found.
-func (d *Dsptchr) UnsubscribeID(evname string, id interface{}) int {
-	// Get list of subscribers for this event
-	// If not found, nothing to do
-	subs, ok := d.evmap[evname]
-	if !ok {
-		return 0
+// SubscribeEvent subscribes a handler receiving each dispatch as an Event,
+// through which the handler may cancel that dispatch alone. The id may be
+// used to unsubscribe, as with SubscribeID.
+func (d *Dsptchr) SubscribeEvent(evname string, id interface{}, h Handler) *Subscription {
+	return d.SubscribeWith(evname, SubscribeOptions{ID: id, HasID: true}, h)
+}
+
+// SubscribeOnce subscribes to receive only the next event with the given name
+// or pattern.
+func (d *Dsptchr) SubscribeOnce(evname string, cb Callback) *Subscription {
+	return d.SubscribeWith(evname, SubscribeOptions{Once: true}, callback(cb))
+}
+
+// SubscribePriority subscribes to receive events with the given name or
+// pattern ahead of subscribers of lower priority.
+func (d *Dsptchr) SubscribePriority(evname string, priority int, cb Callback) *Subscription {
+	return d.SubscribeWith(evname, SubscribeOptions{Priority: priority}, callback(cb))
+}
+
+// SubscribeWith subscribes a handler with the provided options.
+func (d *Dsptchr) SubscribeWith(evname string, o SubscribeOptions, h Handler) *Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	sub := subscription{name: evname, id: o.ID, hasID: o.HasID, h: h, seq: d.seq, priority: o.Priority}
+	if o.Once {
+		sub.once = new(int32)
 	}
+	d.update(evname, func(subs []subscription) []subscription {
+		i := sort.Search(len(subs), func(i int) bool { return sub.before(subs[i]) })
+		ret := make([]subscription, 0, len(subs)+1)
+		ret = append(ret, subs[:i]...)
+		ret = append(ret, sub)
+		return append(ret, subs[i:]...)
+	})
+	return &Subscription{d, evname, sub.seq}
+}
 
-	// Remove all subscribers with the specified id for this event
+func callback(cb Callback) Handler {
+	return func(ev *Event) { cb(ev.Name, ev.Data) }
+}
+
+// Unsubscribe unsubscribes from the specified event and subscription id
+// Returns the number of subscriptions found. Pattern subscriptions are
+// unsubscribed by the same pattern. Subscriptions made without an id, through
+// Subscribe, SubscribeOnce or SubscribePriority, are only removed through
+// their handle.
+func (d *Dsptchr) UnsubscribeID(evname string, id interface{}) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	found := 0
-	pos := 0
-	for pos < len(subs) {
-		if subs[pos].id == id {
-			copy(subs[pos:], subs[pos+1:])
-			subs[len(subs)-1] = subscription{}
-			subs = subs[:len(subs)-1]
+	for _, s := range d.load().current(evname) {
+		if s.is(id) {
 			found++
-		} else {
-			pos++
 		}
 	}
-	//log.Debug("Dispatcher(%p).UnsubscribeID:%s (%p): %v",ed, evname, id, found)
-	d.evmap[evname] = subs
+	if found == 0 {
+		return 0
+	}
+	d.update(evname, func(subs []subscription) []subscription {
+		ret := make([]subscription, 0, len(subs))
+		for _, s := range subs {
+			if !s.is(id) {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	})
+	return found
+}
+
+func (d *Dsptchr) unsubscribe(evname string, seq uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	found := false
+	d.update(evname, func(subs []subscription) []subscription {
+		ret := make([]subscription, 0, len(subs))
+		for _, s := range subs {
+			if s.seq == seq {
+				found = true
+				continue
+			}
+			ret = append(ret, s)
+		}
+		return ret
+	})
 	return found
 }
 
 // Dispatch dispatch the specified event and data to all registered subscribers.
 // The function returns true if the propagation was cancelled by a subscriber.
 func (d *Dsptchr) Dispatch(evname string, ev interface{}) bool {
-	// Get list of subscribers for this event
-	subs := d.evmap[evname]
-	if subs == nil {
+	subs := d.load().match(evname)
+	if len(subs) == 0 {
 		return false
 	}
 
-	// Dispatch to all subscribers
-	d.cancel = false
-	for i := 0; i < len(subs); i++ {
-		subs[i].cb(evname, ev)
-		if d.cancel {
+	mw, _ := d.mw.Load().([]Middleware)
+	e := &Event{Name: evname, Data: ev}
+	d.inflight.Store(e, struct{}{})
+	defer d.inflight.Delete(e)
+	for _, s := range subs {
+		if s.once != nil {
+			if !atomic.CompareAndSwapInt32(s.once, 0, 1) {
+				continue
+			}
+			d.unsubscribe(s.name, s.seq)
+		}
+		if len(mw) > 0 {
+			wrap(s.h, mw)(e)
+		} else {
+			s.h(e)
+		}
+		if e.Cancelled() {
 			break
 		}
 	}
-	return d.cancel
+	return e.Cancelled()
+}
+
+// subscribed returns true if the event has any subscriptions.
+func (d *Dsptchr) subscribed(evname string) bool {
+	return len(d.load().match(evname)) > 0
 }
 
 // ClearSubscriptions clear all subscriptions from this dispatcher
 func (d *Dsptchr) ClearSubscriptions() {
-	d.evmap = make(map[string][]subscription)
+	d.mu.Lock()
+	d.Initialize()
+	d.mu.Unlock()
 }
 
-// CancelDispatch cancels the propagation of the current event.
-// No more subscribers will be called for this event dispatch.
+// CancelDispatch cancels the propagation of every dispatch in progress.
+//
+// Deprecated: with concurrent dispatches CancelDispatch cannot tell which
+// dispatch to cancel; subscribe with SubscribeEvent and use Event.Cancel.
 func (d *Dsptchr) CancelDispatch() {
-	d.cancel = true
+	d.inflight.Range(func(k, _ interface{}) bool {
+		k.(*Event).Cancel()
+		return true
+	})
 }
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestDispatcherConcurrent subscribes, dispatches, unsubscribes and cancels
+// dispatches from many goroutines at once, meant to be run with -race.
+func TestDispatcherConcurrent(t *testing.T) {
+	d := NewDispatcher()
+	var delivered int64
+	d.Subscribe("a.b", func(string, interface{}) { atomic.AddInt64(&delivered, 1) })
+
+	var wg sync.WaitGroup
+	run := func(n int, fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				fn(i)
+			}
+		}()
+	}
+	for g := 0; g < 4; g++ {
+		g := g
+		run(200, func(i int) {
+			s := d.Subscribe("a.b", func(string, interface{}) {})
+			d.SubscribeID("a.*", g, func(string, interface{}) {})
+			d.SubscribeOnce("a.**", func(string, interface{}) {})
+			d.SubscribePriority("a.b", i, func(string, interface{}) {})
+			s.Unsubscribe()
+			d.UnsubscribeID("a.*", g)
+		})
+		run(500, func(i int) {
+			d.Dispatch("a.b", i)
+			d.Dispatch(fmt.Sprintf("a.%d", i%7), i)
+		})
+		run(500, func(i int) {
+			d.SubscribeEvent("a.b", nil, func(ev *Event) {
+				if i%3 == 0 {
+					ev.Cancel()
+				}
+			}).Unsubscribe()
+			if i%50 == 0 {
+				d.CancelDispatch()
+			}
+		})
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&delivered) == 0 {
+		t.Error("no event delivered to the persistent subscriber")
+	}
+	if n := d.UnsubscribeID("a.*", 0); n != 0 {
+		t.Errorf("%d subscriptions left after unsubscribing, expected 0", n)
+	}
+}
@@ -1,45 +1,38 @@
 package core
 
 import (
-	"sort"
+	"io"
+	"runtime"
 	"sync"
 	"sync/atomic"
 
 	"github.com/Laughs-In-Flowers/holo/lib/util/step"
 )
 
-var (
-	counterLock sync.Mutex
-	idInc       uint64
-)
-
+// Entity is a handle to an entity allocated by a World. The id carries both
+// the slot index and the generation of the slot when the handle was issued.
 type Entity interface {
 	ID() uint64
+	Index() uint32
+	Generation() uint32
 }
 
 type entity uint64
 
 type IdentifierSlice []Entity
 
-func NewEntity() entity {
-	return entity(atomic.AddUint64(&idInc, 1))
+func (e entity) ID() uint64 {
+	return uint64(e)
 }
 
-func NewEntitys(amount int) []Entity {
-	entities := make([]Entity, amount)
-
-	counterLock.Lock()
-	for i := 0; i < amount; i++ {
-		idInc++
-		entities[i] = entity(idInc)
-	}
-	counterLock.Unlock()
-
-	return entities
+func (e entity) Index() uint32 {
+	index, _ := unpack(uint64(e))
+	return index
 }
 
-func (e entity) ID() uint64 {
-	return uint64(e)
+func (e entity) Generation() uint32 {
+	_, gen := unpack(uint64(e))
+	return gen
 }
 
 func (is IdentifierSlice) Len() int { return len(is) }
@@ -69,47 +62,395 @@ func (s systems) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 type HandleErrorFn func(error)
 
 type World interface {
-	Add(...System)
+	Dispatcher
+	Add(...System) error
 	Systems() []System
+	RemoveSystem(string) error
+	EnableSystem(string) error
+	DisableSystem(string) error
+	Enabled(string) bool
+	Pause()
+	Resume()
+	Close()
+	Commands() *Commands
+	AddStage(string, string) error
+	SetCadence(string, Cadence) error
+	Stages() []string
 	Update(*step.Step)
+	SetWorkers(int)
+	NewEntity() Entity
+	NewEntitys(int) []Entity
+	IsAlive(Entity) bool
+	Despawn(Entity) bool
+	Len() int
 	Remove(uint64)
+	Attach(Entity, ...Component)
+	Detach(Entity, ...Component) int
+	Component(Entity, Component) (Component, bool)
+	Components(Entity) []Component
+	Has(Entity, ...Component) bool
+	Query() *Query
+	SetParent(Entity, Entity) error
+	Unparent(Entity)
+	Parent(Entity) (Entity, bool)
+	Children(Entity) []Entity
+	Ancestors(Entity) []Entity
+	Descendants(Entity) []Entity
+	HierarchyOrder() []Entity
+	InsertResource(...interface{})
+	Resource(interface{}) (interface{}, error)
+	RemoveResource(interface{}) bool
+	Register(string, interface{}) error
+	LoadPrefabs(io.Reader) error
+	DefinePrefabs(map[string]interface{}) error
+	CheckPrefabs() error
+	Prefabs() []string
+	Spawn(string) (Entity, error)
+	Save(io.Writer, Encoding, Clock) error
+	Load(io.Reader) (Clock, error)
+	Record(int)
+	Mark(float64)
+	Recorded(float64) bool
+	Rewind(float64) error
+	ChangeTick() uint64
+	MarkChanged(Entity, ...Component)
 }
 
 type world struct {
-	hefn    HandleErrorFn
-	systems systems
+	change uint64 // accessed atomically, kept first for alignment
+	frame  uint64 // accessed atomically
+	*Dsptchr
+	ev       *events
+	hefn     HandleErrorFn
+	smu      sync.Mutex
+	stages   []*stage
+	workers  int
+	disabled map[string]bool
+	paused   bool
+	cmds     *Commands
+	mu       sync.RWMutex
+	alloc    *allocator
+	cmp      *components
+	qs       *queries
+	h        *hierarchy
+	rs       *resources
+	reg      *registry
+	pf       *prefabs
+	rec      *recorder
 }
 
 func NewWorld(hefn HandleErrorFn) *world {
-	return &world{
-		hefn,
-		make(systems, 0),
+	workers := runtime.GOMAXPROCS(0)
+	w := &world{
+		Dsptchr:  NewDispatcher(),
+		ev:       &events{},
+		hefn:     hefn,
+		stages:   defaultStages(workers),
+		workers:  workers,
+		disabled: make(map[string]bool),
+		alloc:    newAllocator(),
+		cmp:      newComponents(),
+		qs:       newQueries(),
+		h:        newHierarchy(),
+		rs:       newResources(),
+		reg:      newRegistry(),
+		pf:       newPrefabs(),
+	}
+	w.cmds = newCommands(w)
+	return w
+}
+
+// Add adds systems to the stage each system names, StageUpdate by default,
+// ordering the systems of every stage by their declared constraints and
+// priority. Systems implementing Initializer are initialized before being
+// added. If a stage is unknown, the constraints cannot be satisfied or a
+// system fails to initialize an error is returned and the world is left
+// unchanged.
+func (w *world) Add(s ...System) error {
+	w.smu.Lock()
+	_, err := w.arrange(w.groups(), s)
+	w.smu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = initialize(w, s); err != nil {
+		return err
+	}
+
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	ordered, err := w.arrange(w.groups(), s)
+	if err != nil {
+		shutdown(w, s)
+		return err
+	}
+	w.install(ordered)
+	return nil
+}
+
+// groups returns a copy of the systems of every stage.
+func (w *world) groups() []systems {
+	ret := make([]systems, len(w.stages))
+	for i, st := range w.stages {
+		ret[i] = append(ret[i], st.systems...)
 	}
+	return ret
 }
 
-func (w *world) Add(s ...System) {
+// arrange adds systems to the provided groups and orders every group.
+func (w *world) arrange(groups []systems, s []System) ([]systems, error) {
 	for _, sys := range s {
-		w.systems = append(w.systems, sys)
+		i, _ := w.stage(stageOf(sys))
+		if i < 0 {
+			return nil, unknownStageError(stageOf(sys))
+		}
+		groups[i] = append(groups[i], sys)
+	}
+
+	names, err := stagesOf(groups)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		if groups[i], err = order(groups[i], names, w.stages, i); err != nil {
+			return nil, err
+		}
 	}
-	sort.Sort(w.systems)
+	return groups, nil
 }
 
+func (w *world) install(groups []systems) {
+	for i, st := range w.stages {
+		st.systems = groups[i]
+		st.activate(w)
+	}
+}
+
+// Systems returns every system in the order they run.
 func (w *world) Systems() []System {
-	return w.systems
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	var ret []System
+	for _, st := range w.stages {
+		ret = append(ret, st.systems...)
+	}
+	return ret
 }
 
+// Update runs each stage whose cadence allows it for the provided step, in
+// stage order, skipping disabled systems. Within a stage, systems declaring
+// their component access may run concurrently with systems they do not
+// conflict with; errors are handled in system order once every system of the
+// stage has run. Queued commands are applied at the end of every stage that
+// runs, those of systems in system order followed by the world buffer.
 func (w *world) Update(s *step.Step) {
-	var err error
-	for _, system := range w.systems {
-		err = system.Update(s)
-		if err != nil {
-			w.hefn(err)
+	w.smu.Lock()
+	stages := append([]*stage{}, w.stages...)
+	w.smu.Unlock()
+
+	atomic.StoreUint64(&w.frame, w.ChangeTick())
+	for _, st := range stages {
+		if st.cadence != nil && !st.cadence(s) {
+			continue
+		}
+		w.smu.Lock()
+		active, cmds, ran, g, workers := st.active, st.cmds, st.ran, st.g, st.workers
+		w.smu.Unlock()
+		for i, sys := range active {
+			if cmds[i] != nil {
+				sys.(Commander).SetCommands(cmds[i])
+			}
+		}
+		update := func(i int) error {
+			sys := active[i]
+			if t, ok := sys.(Tracker); ok {
+				t.SetLastRun(atomic.LoadUint64(&ran[i]))
+			}
+			atomic.StoreUint64(&ran[i], w.ChangeTick())
+			return sys.Update(s)
+		}
+		for _, err := range g.run(workers, active, update) {
+			if err != nil {
+				w.hefn(err)
+			}
+		}
+		w.sync(cmds)
+	}
+}
+
+// sync applies the provided system command buffers and the world buffer, then
+// dispatches queued world events.
+func (w *world) sync(cmds []*Commands) {
+	for _, c := range cmds {
+		if c != nil {
+			c.apply()
 		}
 	}
+	w.cmds.apply()
+	w.dispatch()
+}
+
+// SetWorkers sets the number of goroutines used to run systems concurrently.
+// A value of 1 or less runs every system serially.
+func (w *world) SetWorkers(n int) {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	w.workers = n
+	for _, st := range w.stages {
+		st.workers = n
+	}
+}
+
+// NewEntity allocates a new entity, reusing a released slot when available.
+func (w *world) NewEntity() Entity {
+	e := entity(w.alloc.allocate())
+	w.emit(OnSpawn, EntityEvent{e})
+	return e
+}
+
+// NewEntitys allocates the requested number of entities.
+func (w *world) NewEntitys(amount int) []Entity {
+	entities := make([]Entity, amount)
+	for i, id := range w.alloc.allocateN(amount) {
+		entities[i] = entity(id)
+		w.emit(OnSpawn, EntityEvent{entities[i]})
+	}
+	return entities
+}
+
+// IsAlive returns false for entities that were despawned, including handles
+// to a slot that has since been reused.
+func (w *world) IsAlive(e Entity) bool {
+	return w.alloc.isAlive(e.ID())
 }
 
+// Despawn drops every component attached to the entity, informs all systems of
+// the removal and releases the entity slot, invalidating existing handles.
+// Descendants of the entity are despawned along with it. Returns false if the
+// entity was not alive.
+func (w *world) Despawn(e Entity) bool {
+	return w.despawn(e.ID())
+}
+
+// Len returns the number of live entities.
+func (w *world) Len() int {
+	return w.alloc.len()
+}
+
+// Remove despawns the entity with the provided id and its descendants
+// immediately; systems iterating during Update should queue despawns through
+// Commands instead.
 func (w *world) Remove(entity uint64) {
-	for _, sys := range w.systems {
-		sys.Remove(entity)
+	w.despawn(entity)
+}
+
+// despawn removes the entity along with every descendant, children before
+// their parents.
+func (w *world) despawn(root uint64) bool {
+	w.mu.Lock()
+	if !w.alloc.isAlive(root) {
+		w.mu.Unlock()
+		return false
+	}
+	tree := w.h.subtree(root)
+	w.h.unlink(root)
+	removed := make([]uint64, 0, len(tree))
+	observed := w.observed(OnComponentRemove)
+	for i := len(tree) - 1; i >= 0; i-- {
+		id := tree[i]
+		if observed {
+			for _, cmp := range w.cmp.all(id) {
+				w.ev.push(OnComponentRemove, ComponentEvent{Entity: entity(id), Component: cmp})
+			}
+		}
+		for _, s := range w.cmp.clear(id) {
+			w.qs.touched(id, s, nil)
+		}
+		w.h.drop(id)
+		w.alloc.release(id)
+		w.emit(OnDespawn, EntityEvent{entity(id)})
+		removed = append(removed, id)
+	}
+	w.mu.Unlock()
+
+	s := w.Systems()
+	for _, id := range removed {
+		for _, sys := range s {
+			sys.Remove(id)
+		}
+	}
+	return true
+}
+
+// Attach attaches the provided components to the entity, replacing any
+// component of the same type already attached, and stamps them with a new
+// change tick. Components are not attached to entities that are no longer
+// alive.
+func (w *world) Attach(e Entity, c ...Component) {
+	id := e.ID()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.alloc.isAlive(id) {
+		return
+	}
+	tick := w.nextTick()
+	changes := w.observed(OnComponentChange)
+	for _, cmp := range c {
+		var prev Component
+		if changes {
+			prev, _ = w.cmp.get(id, typeOf(cmp))
+		}
+		s, added := w.cmp.attach(id, cmp, tick)
+		if added {
+			w.qs.touched(id, s, w.cmp.entities[id])
+			w.emit(OnComponentAdd, ComponentEvent{Entity: e, Component: cmp})
+		} else if changes {
+			w.ev.push(OnComponentChange, ComponentEvent{e, cmp, prev})
+		}
+	}
+}
+
+// Detach removes components of the same type as those provided from the
+// entity, returning the number of components removed.
+func (w *world) Detach(e Entity, c ...Component) int {
+	id, n := e.ID(), 0
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, cmp := range c {
+		if s, removed, ok := w.cmp.detach(id, typeOf(cmp)); ok {
+			w.qs.touched(id, s, w.cmp.entities[id])
+			w.emit(OnComponentRemove, ComponentEvent{Entity: e, Component: removed})
+			n++
+		}
+	}
+	return n
+}
+
+// Component returns the component attached to the entity sharing the type of
+// the provided component.
+func (w *world) Component(e Entity, c Component) (Component, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cmp.get(e.ID(), typeOf(c))
+}
+
+// Components returns every component attached to the entity.
+func (w *world) Components(e Entity) []Component {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cmp.all(e.ID())
+}
+
+// Has returns true if the entity holds a component of each provided type.
+func (w *world) Has(e Entity, c ...Component) bool {
+	id := e.ID()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, cmp := range c {
+		if _, ok := w.cmp.get(id, typeOf(cmp)); !ok {
+			return false
+		}
 	}
+	return true
 }
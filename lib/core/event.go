@@ -0,0 +1,76 @@
+package core
+
+import "sync"
+
+// The structural events dispatched by a World. Events are queued as changes
+// are made and dispatched at the end of the running stage, or the next stage
+// for changes made outside a world update. Loading a snapshot or rewinding the
+// world dispatches no events.
+const (
+	OnSpawn           = "entity.spawn"
+	OnDespawn         = "entity.despawn"
+	OnComponentAdd    = "component.add"
+	OnComponentChange = "component.change"
+	OnComponentRemove = "component.remove"
+)
+
+// EntityEvent is dispatched with OnSpawn and OnDespawn.
+type EntityEvent struct {
+	Entity Entity
+}
+
+// ComponentEvent is dispatched with OnComponentAdd, OnComponentChange and
+// OnComponentRemove. Previous holds the replaced component of a change.
+type ComponentEvent struct {
+	Entity    Entity
+	Component Component
+	Previous  Component
+}
+
+type event struct {
+	name string
+	data interface{}
+}
+
+// events queues the structural events of a world until the next sync point,
+// so that subscribers are never called while systems run concurrently or
+// while the world is locked.
+type events struct {
+	mu sync.Mutex
+	q  []event
+}
+
+func (e *events) push(name string, data interface{}) {
+	e.mu.Lock()
+	e.q = append(e.q, event{name, data})
+	e.mu.Unlock()
+}
+
+// observed returns true if the event has any subscribers.
+func (w *world) observed(name string) bool {
+	return w.Dsptchr.subscribed(name)
+}
+
+// emit queues the event if it has any subscribers.
+func (w *world) emit(name string, data interface{}) {
+	if w.observed(name) {
+		w.ev.push(name, data)
+	}
+}
+
+// dispatch dispatches every queued event in the order queued, including
+// events queued by subscribers while dispatching.
+func (w *world) dispatch() {
+	for {
+		w.ev.mu.Lock()
+		q := w.ev.q
+		w.ev.q = nil
+		w.ev.mu.Unlock()
+		if len(q) == 0 {
+			return
+		}
+		for _, e := range q {
+			w.Dispatch(e.name, e.data)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+var (
+	deadEntityError     = xrr.Xrror("entity %d is not alive").Out
+	hierarchyCycleError = xrr.Xrror("entity %d cannot be parented to its descendant %d").Out
+)
+
+// hierarchy holds parent and child links between entities. Children are kept
+// in the order they were parented.
+type hierarchy struct {
+	parent   map[uint64]uint64
+	children map[uint64][]uint64
+	dirty    bool // changed since the last rollback frame
+}
+
+func newHierarchy() *hierarchy {
+	return &hierarchy{
+		parent:   make(map[uint64]uint64),
+		children: make(map[uint64][]uint64),
+		dirty:    true,
+	}
+}
+
+func (h *hierarchy) unlink(child uint64) {
+	p, ok := h.parent[child]
+	if !ok {
+		return
+	}
+	delete(h.parent, child)
+	h.dirty = true
+	siblings := h.children[p]
+	for i, c := range siblings {
+		if c == child {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(h.children, p)
+	} else {
+		h.children[p] = siblings
+	}
+}
+
+func (h *hierarchy) link(child, parent uint64) {
+	h.unlink(child)
+	h.dirty = true
+	h.parent[child] = parent
+	h.children[parent] = append(h.children[parent], child)
+}
+
+// drop removes every link of a despawned entity.
+func (h *hierarchy) drop(id uint64) {
+	_, p := h.parent[id]
+	_, c := h.children[id]
+	if p || c {
+		delete(h.parent, id)
+		delete(h.children, id)
+		h.dirty = true
+	}
+}
+
+func (h *hierarchy) isAncestor(ancestor, id uint64) bool {
+	for {
+		p, ok := h.parent[id]
+		if !ok {
+			return false
+		}
+		if p == ancestor {
+			return true
+		}
+		id = p
+	}
+}
+
+// subtree returns the entity and its descendants, parents before children.
+func (h *hierarchy) subtree(id uint64) []uint64 {
+	ret := []uint64{id}
+	for i := 0; i < len(ret); i++ {
+		ret = append(ret, h.children[ret[i]]...)
+	}
+	return ret
+}
+
+// walk appends the entity and its descendants depth first, parents before
+// children.
+func (h *hierarchy) walk(id uint64, ret []Entity) []Entity {
+	ret = append(ret, entity(id))
+	for _, c := range h.children[id] {
+		ret = h.walk(c, ret)
+	}
+	return ret
+}
+
+// SetParent parents child to parent, detaching child from any previous
+// parent. An error is returned if either entity is not alive or parent is child
+// or one of its descendants.
+func (w *world) SetParent(child, parent Entity) error {
+	c, p := child.ID(), parent.ID()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range []uint64{c, p} {
+		if !w.alloc.isAlive(id) {
+			return deadEntityError(id)
+		}
+	}
+	if c == p || w.h.isAncestor(c, p) {
+		return hierarchyCycleError(c, p)
+	}
+	w.h.link(c, p)
+	return nil
+}
+
+// Unparent detaches the entity from its parent, making it a root.
+func (w *world) Unparent(child Entity) {
+	w.mu.Lock()
+	w.h.unlink(child.ID())
+	w.mu.Unlock()
+}
+
+// Parent returns the parent of the entity.
+func (w *world) Parent(e Entity) (Entity, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	p, ok := w.h.parent[e.ID()]
+	if !ok {
+		return nil, false
+	}
+	return entity(p), true
+}
+
+// Children returns the direct children of the entity.
+func (w *world) Children(e Entity) []Entity {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	ids := w.h.children[e.ID()]
+	ret := make([]Entity, len(ids))
+	for i, id := range ids {
+		ret[i] = entity(id)
+	}
+	return ret
+}
+
+// Ancestors returns the ancestors of the entity, nearest first.
+func (w *world) Ancestors(e Entity) []Entity {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var ret []Entity
+	id := e.ID()
+	for {
+		p, ok := w.h.parent[id]
+		if !ok {
+			return ret
+		}
+		ret = append(ret, entity(p))
+		id = p
+	}
+}
+
+// Descendants returns the descendants of the entity depth first, every entity
+// preceding its own children.
+func (w *world) Descendants(e Entity) []Entity {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.h.walk(e.ID(), nil)[1:]
+}
+
+// HierarchyOrder returns every entity taking part in a hierarchy depth first
+// from each root, roots ordered by id, so that every parent precedes its
+// children, e.g. for propagating transforms.
+func (w *world) HierarchyOrder() []Entity {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var roots []uint64
+	for id := range w.h.children {
+		if _, ok := w.h.parent[id]; !ok {
+			roots = append(roots, id)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i] < roots[j] })
+	var ret []Entity
+	for _, id := range roots {
+		ret = w.h.walk(id, ret)
+	}
+	return ret
+}
+
+// SetParent queues parenting child to parent. An error parenting is reported
+// to the world error handler when applied.
+func (c *Commands) SetParent(child, parent Entity) {
+	c.push(func(w *world) {
+		if err := w.SetParent(child, parent); err != nil {
+			w.hefn(err)
+		}
+	})
+}
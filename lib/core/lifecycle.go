@@ -0,0 +1,199 @@
+package core
+
+import "github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+
+// Initializer is implemented by systems requiring setup before they are added
+// to a world. A system failing to initialize is not added.
+type Initializer interface {
+	Init(World) error
+}
+
+// Shutdowner is implemented by systems releasing resources when removed from a
+// world or when the world is closed.
+type Shutdowner interface {
+	Shutdown(World)
+}
+
+// Pauser is implemented by systems notified when they stop and resume being
+// updated, whether by the world pausing or by the system being disabled.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+var (
+	unknownSystemError = xrr.Xrror("unknown system %s").Out
+	initSystemError    = xrr.Xrror("system %s failed to initialize: %s").Out
+)
+
+func initialize(w World, s []System) error {
+	for i, sys := range s {
+		if in, ok := sys.(Initializer); ok {
+			if err := in.Init(w); err != nil {
+				shutdown(w, s[:i])
+				return initSystemError(systemName(sys), err)
+			}
+		}
+	}
+	return nil
+}
+
+// shutdown shuts down systems in the reverse of the provided order.
+func shutdown(w World, s []System) {
+	for i := len(s) - 1; i >= 0; i-- {
+		if sd, ok := s[i].(Shutdowner); ok {
+			sd.Shutdown(w)
+		}
+	}
+}
+
+func pause(s ...System) {
+	for _, sys := range s {
+		if p, ok := sys.(Pauser); ok {
+			p.Pause()
+		}
+	}
+}
+
+func resume(s ...System) {
+	for _, sys := range s {
+		if p, ok := sys.(Pauser); ok {
+			p.Resume()
+		}
+	}
+}
+
+func (w *world) find(name string) (int, int) {
+	for i, st := range w.stages {
+		for j, sys := range st.systems {
+			if systemName(sys) == name {
+				return i, j
+			}
+		}
+	}
+	return -1, -1
+}
+
+// RemoveSystem removes the named system from the world and shuts it down. An
+// error is returned if the system is unknown or other systems are ordered
+// against it.
+func (w *world) RemoveSystem(name string) error {
+	w.smu.Lock()
+	i, j := w.find(name)
+	if i < 0 {
+		w.smu.Unlock()
+		return unknownSystemError(name)
+	}
+	groups := w.groups()
+	sys := groups[i][j]
+	groups[i] = append(groups[i][:j], groups[i][j+1:]...)
+	ordered, err := w.arrange(groups, nil)
+	if err != nil {
+		w.smu.Unlock()
+		return err
+	}
+	delete(w.disabled, name)
+	w.install(ordered)
+	w.smu.Unlock()
+
+	shutdown(w, []System{sys})
+	return nil
+}
+
+func (w *world) toggle(name string, disable bool) error {
+	w.smu.Lock()
+	i, j := w.find(name)
+	if i < 0 {
+		w.smu.Unlock()
+		return unknownSystemError(name)
+	}
+	sys := w.stages[i].systems[j]
+	if w.disabled[name] == disable {
+		w.smu.Unlock()
+		return nil
+	}
+	if disable {
+		w.disabled[name] = true
+	} else {
+		delete(w.disabled, name)
+	}
+	w.stages[i].activate(w)
+	paused := w.paused
+	w.smu.Unlock()
+
+	switch {
+	case paused:
+	case disable:
+		pause(sys)
+	default:
+		resume(sys)
+	}
+	return nil
+}
+
+// EnableSystem resumes updating the named system.
+func (w *world) EnableSystem(name string) error {
+	return w.toggle(name, false)
+}
+
+// DisableSystem stops updating the named system until it is enabled again.
+func (w *world) DisableSystem(name string) error {
+	return w.toggle(name, true)
+}
+
+// Enabled returns true if the named system is present and enabled.
+func (w *world) Enabled(name string) bool {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	i, _ := w.find(name)
+	return i >= 0 && !w.disabled[name]
+}
+
+func (w *world) enabled() []System {
+	var ret []System
+	for _, st := range w.stages {
+		ret = append(ret, st.active...)
+	}
+	return ret
+}
+
+// Pause notifies every enabled system that the world is no longer updated.
+func (w *world) Pause() {
+	w.smu.Lock()
+	if w.paused {
+		w.smu.Unlock()
+		return
+	}
+	w.paused = true
+	s := w.enabled()
+	w.smu.Unlock()
+	pause(s...)
+}
+
+// Resume notifies every enabled system that the world is updated again.
+func (w *world) Resume() {
+	w.smu.Lock()
+	if !w.paused {
+		w.smu.Unlock()
+		return
+	}
+	w.paused = false
+	s := w.enabled()
+	w.smu.Unlock()
+	resume(s...)
+}
+
+// Close removes every system from the world, shutting systems down in the
+// reverse of the order they run.
+func (w *world) Close() {
+	w.smu.Lock()
+	var s []System
+	w.disabled = make(map[string]bool)
+	for _, st := range w.stages {
+		s = append(s, st.systems...)
+		st.systems = nil
+		st.activate(w)
+	}
+	w.smu.Unlock()
+	shutdown(w, s)
+}
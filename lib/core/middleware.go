@@ -0,0 +1,79 @@
+package core
+
+import (
+	"time"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+// Middleware intercepts the delivery of every dispatched event to each of its
+// subscribers, returning a handler that delivers the event by calling next.
+// Middleware may skip next to filter the event, replace the event Data before
+// calling next, time or log the delivery, or recover from a panicking
+// subscriber. Data replaced is seen by every later subscriber of the same
+// dispatch. Middleware added first runs outermost.
+type Middleware func(next Handler) Handler
+
+// subscriberPanicError returns a new error for every panic, as errors made by
+// an xrr.Xrror share its values and panics may be recovered concurrently.
+func subscriberPanicError(evname string, r interface{}) error {
+	return xrr.Xrror("subscriber of %s panicked: %v").Out(evname, r)
+}
+
+// Use adds middleware to every later dispatch.
+func (d *Dsptchr) Use(mw ...Middleware) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	old, _ := d.mw.Load().([]Middleware)
+	next := make([]Middleware, 0, len(old)+len(mw))
+	next = append(next, old...)
+	d.mw.Store(append(next, mw...))
+}
+
+// wrap applies the middleware to the handler of a subscriber.
+func wrap(h Handler, mw []Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Recover returns middleware recovering from a panicking subscriber, so that
+// the dispatch carries on with the next subscriber. fn, if not nil, receives
+// the event along with an error describing the panic.
+func Recover(fn func(*Event, error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ev *Event) {
+			defer func() {
+				if r := recover(); r != nil && fn != nil {
+					fn(ev, subscriberPanicError(ev.Name, r))
+				}
+			}()
+			next(ev)
+		}
+	}
+}
+
+// Filter returns middleware delivering only the events for which keep returns
+// true.
+func Filter(keep func(*Event) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(ev *Event) {
+			if keep(ev) {
+				next(ev)
+			}
+		}
+	}
+}
+
+// Timing returns middleware reporting the time each subscriber takes to handle
+// an event.
+func Timing(fn func(*Event, time.Duration)) Middleware {
+	return func(next Handler) Handler {
+		return func(ev *Event) {
+			start := time.Now()
+			next(ev)
+			fn(ev, time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+// Namer is implemented by systems that other systems may refer to by name.
+type Namer interface {
+	Name() string
+}
+
+// Orderer is implemented by systems declaring the named systems they must run
+// after and before. Ordering constraints take precedence over Priority, which
+// only breaks ties between otherwise unordered systems.
+type Orderer interface {
+	After() []string
+	Before() []string
+}
+
+var (
+	duplicateSystemError = xrr.Xrror("system %s is already present").Out
+	missingSystemError   = xrr.Xrror("system %s must run %s unknown system %s").Out
+	systemCycleError     = xrr.Xrror("system ordering cycle: %s").Out
+)
+
+func systemName(s System) string {
+	if n, ok := s.(Namer); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// staged maps system names to the position of their stage.
+type staged map[string]int
+
+// stagesOf indexes the names of systems grouped by stage.
+func stagesOf(groups []systems) (staged, error) {
+	ret := make(staged)
+	for i, g := range groups {
+		for _, sys := range g {
+			if n, ok := sys.(Namer); ok {
+				if _, exists := ret[n.Name()]; exists {
+					return nil, duplicateSystemError(n.Name())
+				}
+				ret[n.Name()] = i
+			}
+		}
+	}
+	return ret, nil
+}
+
+// order sorts the systems of a stage by their ordering constraints, breaking
+// ties by priority and then by the order systems were provided in.
+// Constraints naming a system of another stage are satisfied by stage order.
+func order(s systems, names staged, stages []*stage, at int) (systems, error) {
+	sorted := make(systems, len(s))
+	copy(sorted, s)
+	sort.Stable(sorted)
+
+	byName := make(map[string]int)
+	for i, sys := range sorted {
+		if n, ok := sys.(Namer); ok {
+			byName[n.Name()] = i
+		}
+	}
+
+	// resolve returns the position of a same stage system, or -1 when the
+	// named system belongs to a stage running on the correct side of this one.
+	resolve := func(sys System, rel, n string, wantEarlier bool) (int, error) {
+		if j, ok := byName[n]; ok {
+			return j, nil
+		}
+		other, ok := names[n]
+		if !ok {
+			return 0, missingSystemError(systemName(sys), rel, n)
+		}
+		if (other < at) != wantEarlier {
+			return 0, stageOrderError(systemName(sys), stages[at].name, rel, n, stages[other].name)
+		}
+		return -1, nil
+	}
+
+	next := make([][]int, len(sorted))
+	waits := make([]int, len(sorted))
+	edge := func(from, to int) {
+		next[from] = append(next[from], to)
+		waits[to]++
+	}
+	for i, sys := range sorted {
+		o, ok := sys.(Orderer)
+		if !ok {
+			continue
+		}
+		for _, n := range o.After() {
+			j, err := resolve(sys, "after", n, true)
+			if err != nil {
+				return nil, err
+			}
+			if j >= 0 {
+				edge(j, i)
+			}
+		}
+		for _, n := range o.Before() {
+			j, err := resolve(sys, "before", n, false)
+			if err != nil {
+				return nil, err
+			}
+			if j >= 0 {
+				edge(i, j)
+			}
+		}
+	}
+
+	ret := make(systems, 0, len(sorted))
+	placed := make([]bool, len(sorted))
+	for len(ret) < len(sorted) {
+		pick := -1
+		for i := range sorted {
+			if !placed[i] && waits[i] == 0 {
+				pick = i
+				break
+			}
+		}
+		if pick < 0 {
+			return nil, systemCycleError(cycle(sorted, next, placed))
+		}
+		placed[pick] = true
+		ret = append(ret, sorted[pick])
+		for _, j := range next[pick] {
+			waits[j]--
+		}
+	}
+	return ret, nil
+}
+
+// cycle describes one ordering cycle among the systems not yet placed.
+func cycle(s systems, next [][]int, placed []bool) string {
+	state := make([]int, len(s)) // 0 unvisited, 1 on path, 2 done
+	var path []int
+	var found []int
+	var visit func(int) bool
+	visit = func(i int) bool {
+		state[i] = 1
+		path = append(path, i)
+		for _, j := range next[i] {
+			if placed[j] {
+				continue
+			}
+			if state[j] == 1 {
+				for k, p := range path {
+					if p == j {
+						found = append(append(found, path[k:]...), j)
+						return true
+					}
+				}
+			}
+			if state[j] == 0 && visit(j) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = 2
+		return false
+	}
+	for i := range s {
+		if !placed[i] && state[i] == 0 && visit(i) {
+			break
+		}
+	}
+	names := make([]string, len(found))
+	for i, j := range found {
+		names[i] = systemName(s[j])
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,298 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+var (
+	prefabSyntaxError    = xrr.Xrror("malformed prefabs: %s").Out
+	prefabError          = xrr.Xrror("prefab %s: %s").Out
+	unknownPrefabError   = xrr.Xrror("unknown prefab %s").Out
+	duplicatePrefabError = xrr.Xrror("prefab %s is already defined").Out
+)
+
+// A prefab describes an entity by the registered names of its components and
+// their field values. A prefab extending another starts from the components of
+// its parent: fields it provides override those of the parent, other fields are
+// kept, and a null component drops the parent component. In JSON:
+//
+//	{
+//	  "orc": {"components": {"position": {}, "health": {"Max": 10}}},
+//	  "orc_archer": {"extends": "orc", "components": {"health": {"Max": 8}, "bow": {"Range": 5}}}
+//	}
+type prefab struct {
+	extends    string
+	components map[string]interface{}
+}
+
+// compiled holds the resolved component values of a prefab, decoded afresh on
+// every spawn so that spawned entities never share pointer components.
+type compiled struct {
+	types []reflect.Type
+	data  [][]byte
+}
+
+type prefabs struct {
+	mu       sync.RWMutex
+	defs     map[string]prefab
+	compiled map[string]*compiled
+}
+
+func newPrefabs() *prefabs {
+	return &prefabs{
+		defs:     make(map[string]prefab),
+		compiled: make(map[string]*compiled),
+	}
+}
+
+func definePrefab(name string, v interface{}) (prefab, error) {
+	var p prefab
+	body, ok := v.(map[string]interface{})
+	if !ok {
+		return p, prefabError(name, "must be a map")
+	}
+	for k, e := range body {
+		switch k {
+		case "extends":
+			s, ok := e.(string)
+			if !ok {
+				return p, prefabError(name, "extends must name a prefab")
+			}
+			p.extends = s
+		case "components":
+			cs, ok := e.(map[string]interface{})
+			if !ok && e != nil {
+				return p, prefabError(name, "components must be a map of type names to values")
+			}
+			p.components = cs
+		default:
+			return p, prefabError(name, "unknown key "+k)
+		}
+	}
+	return p, nil
+}
+
+// merge returns over applied on top of base, merging nested maps.
+func merge(base, over interface{}) interface{} {
+	b, bok := base.(map[string]interface{})
+	o, ook := over.(map[string]interface{})
+	if !bok || !ook {
+		return over
+	}
+	ret := make(map[string]interface{}, len(b)+len(o))
+	for k, v := range b {
+		ret[k] = v
+	}
+	for k, v := range o {
+		ret[k] = merge(ret[k], v)
+	}
+	return ret
+}
+
+// resolve returns the components of the named prefab with every ancestor
+// applied. The prefabs must be read locked.
+func (ps *prefabs) resolve(name string, seen []string) (map[string]interface{}, error) {
+	for i, s := range seen {
+		if s != name {
+			continue
+		}
+		if i == len(seen)-1 {
+			return nil, prefabError(name, "extends itself")
+		}
+		cycle := append(append([]string{}, seen[i:]...), name)
+		return nil, prefabError(name, "extends itself through "+strings.Join(cycle, " -> "))
+	}
+	p, ok := ps.defs[name]
+	if !ok {
+		if len(seen) > 0 {
+			return nil, prefabError(seen[len(seen)-1], "extends unknown prefab "+name)
+		}
+		return nil, unknownPrefabError(name)
+	}
+	ret := make(map[string]interface{})
+	if p.extends != "" {
+		base, err := ps.resolve(p.extends, append(seen, name))
+		if err != nil {
+			return nil, err
+		}
+		ret = base
+	}
+	for k, v := range p.components {
+		if v == nil {
+			delete(ret, k)
+			continue
+		}
+		ret[k] = merge(ret[k], v)
+	}
+	return ret, nil
+}
+
+// compile resolves the named prefab and checks every component value against
+// its registered type.
+func (ps *prefabs) compile(name string, reg *registry) (*compiled, error) {
+	ps.mu.RLock()
+	c, ok := ps.compiled[name]
+	if ok {
+		ps.mu.RUnlock()
+		return c, nil
+	}
+	cs, err := ps.resolve(name, nil)
+	ps.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(cs))
+	for n := range cs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	c = &compiled{}
+	for _, n := range names {
+		t, ok := reg.typeOf(n)
+		if !ok {
+			return nil, prefabError(name, unregisteredTypeError(n))
+		}
+		data, err := json.Marshal(cs[n])
+		if err != nil {
+			return nil, prefabError(name, err)
+		}
+		if _, err := decodePrefab(t, data); err != nil {
+			return nil, prefabError(name, fmt.Sprintf("component %s: %s", n, err))
+		}
+		c.types = append(c.types, t)
+		c.data = append(c.data, data)
+	}
+
+	ps.mu.Lock()
+	ps.compiled[name] = c
+	ps.mu.Unlock()
+	return c, nil
+}
+
+// decodePrefab decodes a component value, rejecting fields the type lacks.
+func decodePrefab(t reflect.Type, data []byte) (Component, error) {
+	ptr := reflect.New(t)
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(ptr.Interface()); err != nil {
+		return nil, err
+	}
+	v := ptr.Elem()
+	if t.Kind() == reflect.Ptr && v.IsNil() {
+		v.Set(reflect.New(t.Elem()))
+	}
+	return v.Interface(), nil
+}
+
+// LoadPrefabs reads a JSON map of prefab names to prefab definitions and
+// defines them as DefinePrefabs does.
+func (w *world) LoadPrefabs(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return prefabSyntaxError(err)
+	}
+	return w.DefinePrefabs(raw)
+}
+
+// DefinePrefabs defines a map of prefab names to prefab definitions, given as
+// maps keyed by strings in the shape JSON decodes to, so that prefabs may be
+// decoded from any format. Component names must be registered with Register
+// before prefabs are checked or spawned. Nothing is defined if any prefab is
+// malformed or already defined.
+func (w *world) DefinePrefabs(raw map[string]interface{}) error {
+	defs := make(map[string]prefab, len(raw))
+	for name, v := range raw {
+		p, err := definePrefab(name, v)
+		if err != nil {
+			return err
+		}
+		defs[name] = p
+	}
+
+	w.pf.mu.Lock()
+	defer w.pf.mu.Unlock()
+	for name := range defs {
+		if _, ok := w.pf.defs[name]; ok {
+			return duplicatePrefabError(name)
+		}
+	}
+	for name, p := range defs {
+		w.pf.defs[name] = p
+	}
+	return nil
+}
+
+// CheckPrefabs resolves every defined prefab, returning the first error found
+// in name order: an unknown or cyclic parent, an unregistered component name
+// or a component value not matching its type.
+func (w *world) CheckPrefabs() error {
+	for _, name := range w.Prefabs() {
+		if _, err := w.pf.compile(name, w.reg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prefabs returns the names of every defined prefab.
+func (w *world) Prefabs() []string {
+	w.pf.mu.RLock()
+	defer w.pf.mu.RUnlock()
+	ret := make([]string, 0, len(w.pf.defs))
+	for n := range w.pf.defs {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// instantiate decodes fresh component values of the named prefab.
+func (w *world) instantiate(name string) ([]Component, error) {
+	c, err := w.pf.compile(name, w.reg)
+	if err != nil {
+		return nil, err
+	}
+	cs := make([]Component, len(c.types))
+	for i, t := range c.types {
+		if cs[i], err = decodePrefab(t, c.data[i]); err != nil {
+			return nil, prefabError(name, err)
+		}
+	}
+	return cs, nil
+}
+
+// Spawn allocates an entity holding the components of the named prefab.
+func (w *world) Spawn(name string) (Entity, error) {
+	cs, err := w.instantiate(name)
+	if err != nil {
+		return nil, err
+	}
+	e := w.NewEntity()
+	w.Attach(e, cs...)
+	return e, nil
+}
+
+// SpawnPrefab allocates an entity immediately and queues attaching the
+// components of the named prefab.
+func (c *Commands) SpawnPrefab(name string) (Entity, error) {
+	cs, err := c.w.instantiate(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Spawn(cs...), nil
+}
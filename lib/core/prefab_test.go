@@ -0,0 +1,25 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrefabCycle(t *testing.T) {
+	for _, c := range []struct {
+		defs, want string
+	}{
+		{`{"a": {"extends": "a"}}`, "prefab a: extends itself"},
+		{`{"a": {"extends": "b"}, "b": {"extends": "a"}}`, "prefab a: extends itself through a -> b -> a"},
+		{`{"a": {"extends": "b"}, "b": {"extends": "c"}, "c": {"extends": "b"}}`, "prefab b: extends itself through b -> c -> b"},
+	} {
+		w := NewWorld(func(err error) { t.Error(err) })
+		if err := w.LoadPrefabs(strings.NewReader(c.defs)); err != nil {
+			t.Fatal(err)
+		}
+		err := w.CheckPrefabs()
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: got error %v, expected %q", c.defs, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Query selects entities by the component types they do or do not hold.
+// Matching sets are cached by the world between ticks and kept up to date
+// incrementally as components are attached and detached.
+type Query struct {
+	w       *world
+	with    []reflect.Type
+	without []reflect.Type
+	added   []reflect.Type
+	changed []reflect.Type
+	since   *uint64
+	c       *cached
+}
+
+// With restricts the query to entities holding components of every provided
+// type.
+func (q *Query) With(c ...Component) *Query {
+	for _, cmp := range c {
+		q.with = append(q.with, typeOf(cmp))
+	}
+	q.c = nil
+	return q
+}
+
+// Without excludes entities holding a component of any provided type.
+func (q *Query) Without(c ...Component) *Query {
+	for _, cmp := range c {
+		q.without = append(q.without, typeOf(cmp))
+	}
+	q.c = nil
+	return q
+}
+
+func (q *Query) cached() *cached {
+	if q.c == nil {
+		q.w.mu.Lock()
+		q.c = q.w.cachedQuery(q.with, q.without)
+		q.w.mu.Unlock()
+	}
+	return q.c
+}
+
+// Len returns the number of entities matching the query.
+func (q *Query) Len() int {
+	c := q.cached()
+	q.w.mu.RLock()
+	defer q.w.mu.RUnlock()
+	return len(q.ids(c))
+}
+
+// Iter returns an iterator over the entities matching the query when Iter is
+// called.
+func (q *Query) Iter() *Iterator {
+	c := q.cached()
+	q.w.mu.RLock()
+	defer q.w.mu.RUnlock()
+	ids := append([]uint64{}, q.ids(c)...)
+	return &Iterator{w: q.w, c: c, ids: ids, i: len(ids)}
+}
+
+// Each calls fn for every entity matching the query.
+func (q *Query) Each(fn func(Entity)) {
+	it := q.Iter()
+	for it.Next() {
+		fn(it.Entity())
+	}
+}
+
+// Entities returns a copy of the entities matching the query.
+func (q *Query) Entities() []Entity {
+	c := q.cached()
+	q.w.mu.RLock()
+	defer q.w.mu.RUnlock()
+	ids := q.ids(c)
+	ret := make([]Entity, len(ids))
+	for i, id := range ids {
+		ret[i] = entity(id)
+	}
+	return ret
+}
+
+// Iterator walks a copy of the matching set of a query taken by Iter, from the
+// end. Entities leaving the matching set while iterating, e.g. despawned along
+// with the current entity, are skipped; entities joining it are not visited.
+type Iterator struct {
+	w   *world
+	c   *cached
+	ids []uint64
+	i   int
+	id  uint64
+}
+
+// Next advances the iterator, returning false when no entities remain.
+func (it *Iterator) Next() bool {
+	for {
+		it.i--
+		if it.i < 0 {
+			return false
+		}
+		id := it.ids[it.i]
+		it.w.mu.RLock()
+		_, ok := it.c.index[id]
+		it.w.mu.RUnlock()
+		if ok {
+			it.id = id
+			return true
+		}
+	}
+}
+
+// Entity returns the current entity.
+func (it *Iterator) Entity() Entity {
+	return entity(it.id)
+}
+
+// Get returns the component of the current entity sharing the type of the
+// provided component, or nil if the entity holds none.
+func (it *Iterator) Get(c Component) Component {
+	it.w.mu.RLock()
+	cmp, _ := it.w.cmp.get(it.id, typeOf(c))
+	it.w.mu.RUnlock()
+	return cmp
+}
+
+// cached is the maintained matching set of a query signature.
+type cached struct {
+	with    mask
+	without mask
+	index   map[uint64]int
+	ids     []uint64
+	dirty   bool // changed since the last rollback frame
+	// seedFrom is the smallest store required when the set was created
+	seedFrom *store
+}
+
+func (c *cached) matches(m mask) bool {
+	for i, v := range c.with {
+		if i >= len(m) || m[i]&v != v {
+			return false
+		}
+	}
+	for i, v := range c.without {
+		if i < len(m) && m[i]&v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cached) add(id uint64) {
+	if _, ok := c.index[id]; ok {
+		return
+	}
+	c.index[id] = len(c.ids)
+	c.ids = append(c.ids, id)
+	c.dirty = true
+}
+
+func (c *cached) remove(id uint64) {
+	i, ok := c.index[id]
+	if !ok {
+		return
+	}
+	last := len(c.ids) - 1
+	if i != last {
+		c.ids[i] = c.ids[last]
+		c.index[c.ids[i]] = i
+	}
+	c.ids = c.ids[:last]
+	delete(c.index, id)
+	c.dirty = true
+}
+
+// update re-evaluates membership of the entity with the provided mask.
+func (c *cached) update(id uint64, m mask) {
+	if !m.empty() && c.matches(m) {
+		c.add(id)
+	} else {
+		c.remove(id)
+	}
+}
+
+// queries caches matching sets by signature and tracks which sets must be
+// re-evaluated when a component of a given store changes membership.
+type queries struct {
+	bySig   map[string]*cached
+	byStore map[uint][]*cached
+	any     []*cached
+}
+
+func newQueries() *queries {
+	return &queries{
+		bySig:   make(map[string]*cached),
+		byStore: make(map[uint][]*cached),
+	}
+}
+
+func signature(with, without mask) string {
+	var b strings.Builder
+	for _, v := range with {
+		fmt.Fprintf(&b, "%x.", v)
+	}
+	b.WriteByte('|')
+	for _, v := range without {
+		fmt.Fprintf(&b, "%x.", v)
+	}
+	return b.String()
+}
+
+// touched re-evaluates the entity against every cached set watching store s.
+func (q *queries) touched(id uint64, s *store, m mask) {
+	for _, c := range q.byStore[s.bit] {
+		c.update(id, m)
+	}
+	for _, c := range q.any {
+		c.update(id, m)
+	}
+}
+
+// Query returns a new query against the world.
+func (w *world) Query() *Query {
+	return &Query{w: w}
+}
+
+func (w *world) cachedQuery(with, without []reflect.Type) *cached {
+	var wm, wom, watch mask
+	var smallest *store
+	for _, t := range with {
+		s := w.cmp.storeFor(t)
+		wm = wm.set(s.bit)
+		watch = watch.set(s.bit)
+		if smallest == nil || s.len() < smallest.len() {
+			smallest = s
+		}
+	}
+	for _, t := range without {
+		s := w.cmp.storeFor(t)
+		wom = wom.set(s.bit)
+		watch = watch.set(s.bit)
+	}
+
+	sig := signature(wm, wom)
+	if c, ok := w.qs.bySig[sig]; ok {
+		return c
+	}
+
+	c := &cached{with: wm, without: wom, dirty: true}
+	w.seed(c, smallest)
+
+	w.qs.bySig[sig] = c
+	c.seedFrom = smallest
+	if len(with) == 0 {
+		w.qs.any = append(w.qs.any, c)
+	}
+	for _, s := range w.cmp.byBit {
+		if watch.has(s.bit) && len(with) > 0 {
+			w.qs.byStore[s.bit] = append(w.qs.byStore[s.bit], c)
+		}
+	}
+	return c
+}
+
+// seed fills the matching set from the provided store, or every store when
+// nothing is required, so the initial order follows insertion rather than map
+// order.
+func (w *world) seed(c *cached, from *store) {
+	c.index = make(map[uint64]int)
+	c.ids = nil
+	seed := []*store{from}
+	if from == nil {
+		seed = w.cmp.byBit
+	}
+	for _, s := range seed {
+		for _, id := range s.ids {
+			if m := w.cmp.entities[id]; !m.empty() && c.matches(m) {
+				c.add(id)
+			}
+		}
+	}
+}
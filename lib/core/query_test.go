@@ -0,0 +1,47 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEachDespawnSubtree(t *testing.T) {
+	w := NewWorld(func(err error) { t.Error(err) })
+	es := w.NewEntitys(4)
+	for _, e := range es {
+		w.Attach(e, pos{})
+	}
+	for _, c := range es[1:3] {
+		if err := w.SetParent(c, es[3]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var visited []Entity
+	w.Query().With(pos{}).Each(func(e Entity) {
+		visited = append(visited, e)
+		if e == es[3] {
+			w.Despawn(e)
+		}
+	})
+	if expect := []Entity{es[3], es[0]}; !reflect.DeepEqual(visited, expect) {
+		t.Errorf("visited %v, expected %v", visited, expect)
+	}
+}
+
+func TestEachDetachCurrent(t *testing.T) {
+	w := NewWorld(func(err error) { t.Error(err) })
+	es := w.NewEntitys(5)
+	for _, e := range es {
+		w.Attach(e, pos{})
+	}
+	n := 0
+	q := w.Query().With(pos{})
+	q.Each(func(e Entity) {
+		n++
+		w.Detach(e, pos{})
+	})
+	if n != 5 || q.Len() != 0 {
+		t.Errorf("visited %d entities leaving %d, expected 5 leaving 0", n, q.Len())
+	}
+}
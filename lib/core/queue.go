@@ -0,0 +1,96 @@
+package core
+
+import "sync"
+
+// Overflow selects what Enqueue does when a bounded event queue is full.
+type Overflow int
+
+const (
+	// DropNewest discards the event being enqueued.
+	DropNewest Overflow = iota
+	// DropOldest discards the oldest queued event to make room.
+	DropOldest
+	// Block waits for a flush to make room. Enqueueing from a subscriber
+	// while flushing, or from the only goroutine flushing, never returns.
+	Block
+)
+
+// queue buffers events for a later Flush.
+type queue struct {
+	mu       sync.Mutex
+	room     *sync.Cond
+	events   []event
+	limit    int
+	overflow Overflow
+	dropped  int
+}
+
+// q returns the queue of the dispatcher, created on first use.
+func (d *Dsptchr) q() *queue {
+	d.qonce.Do(func() {
+		d.queue = &queue{}
+		d.queue.room = sync.NewCond(&d.queue.mu)
+	})
+	return d.queue
+}
+
+// SetQueueLimit bounds the number of queued events, applying the overflow
+// policy to events enqueued beyond it. A limit below 1 leaves the queue
+// unbounded, the default.
+func (d *Dsptchr) SetQueueLimit(limit int, o Overflow) {
+	q := d.q()
+	q.mu.Lock()
+	q.limit, q.overflow = limit, o
+	q.room.Broadcast()
+	q.mu.Unlock()
+}
+
+// Enqueue buffers an event to be dispatched by the next Flush rather than
+// dispatching it immediately. Returns false if the event was discarded by a
+// full queue.
+func (d *Dsptchr) Enqueue(evname string, ev interface{}) bool {
+	q := d.q()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.limit > 0 && len(q.events) >= q.limit {
+		switch q.overflow {
+		case DropOldest:
+			copy(q.events, q.events[1:])
+			q.events[len(q.events)-1] = event{}
+			q.events = q.events[:len(q.events)-1]
+			q.dropped++
+		case Block:
+			q.room.Wait()
+		default:
+			q.dropped++
+			return false
+		}
+	}
+	q.events = append(q.events, event{evname, ev})
+	return true
+}
+
+// Flush dispatches the events queued when the flush starts, in the order they
+// were enqueued, returning the number dispatched. Events enqueued while
+// flushing, including by subscribers, are left for the next flush.
+func (d *Dsptchr) Flush() int {
+	q := d.q()
+	q.mu.Lock()
+	events := q.events
+	q.events = nil
+	q.room.Broadcast()
+	q.mu.Unlock()
+	for _, e := range events {
+		d.Dispatch(e.name, e.data)
+	}
+	return len(events)
+}
+
+// Queued returns the number of events waiting for the next flush along with
+// the number discarded by a full queue so far.
+func (d *Dsptchr) Queued() (int, int) {
+	q := d.q()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events), q.dropped
+}
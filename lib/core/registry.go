@@ -0,0 +1,75 @@
+package core
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+var duplicateRegisterError = xrr.Xrror("type name %s is already registered to %s").Out
+
+// registry maps names to component and resource types, allowing values to be
+// described outside of Go, e.g. in snapshots.
+type registry struct {
+	mu     sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}
+
+func newRegistry() *registry {
+	return &registry{
+		byName: make(map[string]reflect.Type),
+		byType: make(map[reflect.Type]string),
+	}
+}
+
+func (r *registry) register(name string, t reflect.Type) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if have, ok := r.byName[name]; ok {
+		if have == t {
+			return nil
+		}
+		return duplicateRegisterError(name, have)
+	}
+	if have, ok := r.byType[t]; ok {
+		return duplicateRegisterError(have, t)
+	}
+	r.byName[name] = t
+	r.byType[t] = name
+	return nil
+}
+
+func (r *registry) typeOf(name string) (reflect.Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byName[name]
+	return t, ok
+}
+
+func (r *registry) nameOf(t reflect.Type) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, ok := r.byType[t]
+	return n, ok
+}
+
+func (r *registry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := make([]string, 0, len(r.byName))
+	for n := range r.byName {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Register names the type of the provided component or resource, e.g.
+// Register("position", Position{}). A name may only be registered to a single
+// type and a type may only carry a single name.
+func (w *world) Register(name string, v interface{}) error {
+	return w.reg.register(name, reflect.TypeOf(v))
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+var missingResourceError = xrr.Xrror("no resource of type %s in world").Out
+
+// resources holds a single value of each type shared across a world. Like
+// components, resource types may be declared through Accessor so that systems
+// touching the same resource never run at once.
+type resources struct {
+	mu sync.RWMutex
+	m  map[reflect.Type]interface{}
+}
+
+func newResources() *resources {
+	return &resources{m: make(map[reflect.Type]interface{})}
+}
+
+// InsertResource stores each value as the world resource of its type,
+// replacing any resource of the same type. Pointer resources may be modified
+// in place by systems, other resources are replaced by inserting again. When
+// recording for rollback, the values pointer resources point to are copied
+// shallowly on every step and restored in place when rewinding.
+func (w *world) InsertResource(r ...interface{}) {
+	w.rs.mu.Lock()
+	for _, v := range r {
+		w.rs.m[reflect.TypeOf(v)] = v
+	}
+	w.rs.mu.Unlock()
+}
+
+// Resource returns the resource sharing the type of the provided value, e.g.
+// Resource((*Score)(nil)), or an error naming the type if none is present.
+func (w *world) Resource(r interface{}) (interface{}, error) {
+	t := reflect.TypeOf(r)
+	w.rs.mu.RLock()
+	v, ok := w.rs.m[t]
+	w.rs.mu.RUnlock()
+	if !ok {
+		return nil, missingResourceError(t)
+	}
+	return v, nil
+}
+
+// RemoveResource removes the resource sharing the type of the provided value,
+// returning false if none was present.
+func (w *world) RemoveResource(r interface{}) bool {
+	t := reflect.TypeOf(r)
+	w.rs.mu.Lock()
+	defer w.rs.mu.Unlock()
+	_, ok := w.rs.m[t]
+	delete(w.rs.m, t)
+	return ok
+}
@@ -0,0 +1,309 @@
+package core
+
+import (
+	"reflect"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+var unrecordedTickError = xrr.Xrror("no recorded world state for step %f").Out
+
+// A frame is the state of a world at the end of a step. Frames are built
+// incrementally: only structures changed since the previous frame are copied,
+// unchanged structures share the copy held by the previous frame. Copies are
+// never modified once taken. Components are copied shallowly, so components
+// recorded for rollback should be values, or pointers replaced rather than
+// modified in place. Resources are copied on every frame, as pointer resources
+// may be modified in place, the values they point to being copied shallowly.
+type frame struct {
+	tick   float64
+	alloc  *allocatorState
+	stores map[*store]*storeFrame
+	sets   map[*cached][]uint64
+	h      *hierarchy
+	res    map[reflect.Type]interface{}
+}
+
+type storeFrame struct {
+	ids     []uint64
+	data    []Component
+	added   []uint64
+	changed []uint64
+}
+
+// recorder is a ring buffer of frames.
+type recorder struct {
+	capacity int
+	frames   []*frame
+}
+
+func (r *recorder) last() *frame {
+	if len(r.frames) == 0 {
+		return nil
+	}
+	return r.frames[len(r.frames)-1]
+}
+
+func (r *recorder) push(f *frame) {
+	r.frames = append(r.frames, f)
+	r.trim()
+}
+
+// trim drops the oldest frames beyond capacity.
+func (r *recorder) trim() {
+	if over := len(r.frames) - r.capacity; over > 0 {
+		copy(r.frames, r.frames[over:])
+		for i := len(r.frames) - over; i < len(r.frames); i++ {
+			r.frames[i] = nil
+		}
+		r.frames = r.frames[:len(r.frames)-over]
+	}
+}
+
+func (r *recorder) find(tick float64) int {
+	for i := len(r.frames) - 1; i >= 0; i-- {
+		if r.frames[i].tick == tick {
+			return i
+		}
+	}
+	return -1
+}
+
+// changed returns the allocator state if changed since the last frame, or
+// regardless when forced.
+func (a *allocator) changed(force bool) (*allocatorState, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.dirty && !force {
+		return nil, false
+	}
+	a.dirty = false
+	return &allocatorState{
+		Gens:  append([]uint32{}, a.gens...),
+		Alive: append([]bool{}, a.alive...),
+		Free:  append([]uint32{}, a.free...),
+	}, true
+}
+
+// copyResource returns a resource, or a shallow copy of the value of a pointer
+// resource.
+func copyResource(v interface{}) interface{} {
+	p := reflect.ValueOf(v)
+	if p.Kind() != reflect.Ptr || p.IsNil() {
+		return v
+	}
+	c := reflect.New(p.Type().Elem())
+	c.Elem().Set(p.Elem())
+	return c.Interface()
+}
+
+// restoreResource sets the value a pointer resource points to from a copy,
+// returning false if either is not a pointer.
+func restoreResource(dst, src interface{}) bool {
+	d, s := reflect.ValueOf(dst), reflect.ValueOf(src)
+	if d.Kind() != reflect.Ptr || d.IsNil() || s.Kind() != reflect.Ptr || s.IsNil() {
+		return false
+	}
+	d.Elem().Set(s.Elem())
+	return true
+}
+
+func copyHierarchy(h *hierarchy) *hierarchy {
+	ret := newHierarchy()
+	for c, p := range h.parent {
+		ret.parent[c] = p
+	}
+	for p, cs := range h.children {
+		ret.children[p] = append([]uint64{}, cs...)
+	}
+	return ret
+}
+
+// Record keeps the state of the world for up to capacity marked steps. A
+// capacity below 1 stops recording and drops every recorded step.
+func (w *world) Record(capacity int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if capacity < 1 {
+		w.rec = nil
+		return
+	}
+	if w.rec == nil {
+		w.rec = &recorder{}
+	}
+	w.rec.capacity = capacity
+	w.rec.trim()
+}
+
+// Mark records the current state of the world as the state at the end of the
+// provided step, replacing any later recorded steps. Mark does nothing unless
+// recording.
+func (w *world) Mark(tick float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.rec == nil {
+		return
+	}
+	prev := w.rec.last()
+	f := &frame{
+		tick:   tick,
+		stores: make(map[*store]*storeFrame, len(w.cmp.byBit)),
+		sets:   make(map[*cached][]uint64, len(w.qs.bySig)),
+	}
+
+	if st, ok := w.alloc.changed(prev == nil); ok {
+		f.alloc = st
+	} else {
+		f.alloc = prev.alloc
+	}
+
+	for _, s := range w.cmp.byBit {
+		sf, ok := (*storeFrame)(nil), false
+		if prev != nil {
+			sf, ok = prev.stores[s]
+		}
+		if !ok || s.dirty {
+			sf = &storeFrame{
+				ids:     append([]uint64{}, s.ids...),
+				data:    append([]Component{}, s.data...),
+				added:   append([]uint64{}, s.added...),
+				changed: append([]uint64{}, s.changed...),
+			}
+			s.dirty = false
+		}
+		f.stores[s] = sf
+	}
+
+	for _, c := range w.qs.bySig {
+		ids, ok := []uint64(nil), false
+		if prev != nil {
+			ids, ok = prev.sets[c]
+		}
+		if !ok || c.dirty {
+			ids = append([]uint64{}, c.ids...)
+			c.dirty = false
+		}
+		f.sets[c] = ids
+	}
+
+	if prev == nil || w.h.dirty {
+		f.h = copyHierarchy(w.h)
+		w.h.dirty = false
+	} else {
+		f.h = prev.h
+	}
+
+	w.rs.mu.RLock()
+	f.res = make(map[reflect.Type]interface{}, len(w.rs.m))
+	for t, v := range w.rs.m {
+		f.res[t] = copyResource(v)
+	}
+	w.rs.mu.RUnlock()
+
+	if i := w.rec.find(tick); i >= 0 {
+		w.rec.frames = w.rec.frames[:i]
+	}
+	w.rec.push(f)
+}
+
+// Recorded returns true if the state of the world at the end of the provided
+// step may be rewound to.
+func (w *world) Recorded(tick float64) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.rec != nil && w.rec.find(tick) >= 0
+}
+
+// Rewind restores the world to the state recorded at the end of the provided
+// step, dropping every later recorded step along with pending world commands
+// and events. Systems are kept and informed of entities no longer alive.
+func (w *world) Rewind(tick float64) error {
+	w.mu.Lock()
+	if w.rec == nil {
+		w.mu.Unlock()
+		return unrecordedTickError(tick)
+	}
+	i := w.rec.find(tick)
+	if i < 0 {
+		w.mu.Unlock()
+		return unrecordedTickError(tick)
+	}
+	f := w.rec.frames[i]
+	w.rec.frames = w.rec.frames[:i+1]
+
+	prev := w.alloc.state()
+	w.alloc.restore(allocatorState{
+		Gens:  append([]uint32{}, f.alloc.Gens...),
+		Alive: append([]bool{}, f.alloc.Alive...),
+		Free:  append([]uint32{}, f.alloc.Free...),
+	})
+
+	w.cmp.entities = make(map[uint64]mask)
+	for _, s := range w.cmp.byBit {
+		s.index = make(map[uint64]int)
+		s.ids, s.data, s.added, s.changed = nil, nil, nil, nil
+		if sf, ok := f.stores[s]; ok {
+			s.ids = append(s.ids, sf.ids...)
+			s.data = append(s.data, sf.data...)
+			s.added = append(s.added, sf.added...)
+			s.changed = append(s.changed, sf.changed...)
+		}
+		for j, id := range s.ids {
+			s.index[id] = j
+			w.cmp.entities[id] = w.cmp.entities[id].set(s.bit)
+		}
+		s.dirty = false
+	}
+
+	for _, c := range w.qs.bySig {
+		if ids, ok := f.sets[c]; ok {
+			c.index = make(map[uint64]int, len(ids))
+			c.ids = append([]uint64{}, ids...)
+			for j, id := range c.ids {
+				c.index[id] = j
+			}
+		} else {
+			w.seed(c, c.seedFrom)
+		}
+		c.dirty = false
+	}
+
+	w.h = copyHierarchy(f.h)
+	w.h.dirty = false
+
+	w.rs.mu.Lock()
+	res := make(map[reflect.Type]interface{}, len(f.res))
+	for t, v := range f.res {
+		if cur, ok := w.rs.m[t]; ok && restoreResource(cur, v) {
+			res[t] = cur
+			continue
+		}
+		res[t] = copyResource(v)
+	}
+	w.rs.m = res
+	w.rs.mu.Unlock()
+
+	w.cmds.mu.Lock()
+	w.cmds.ops = nil
+	w.cmds.mu.Unlock()
+	w.ev.mu.Lock()
+	w.ev.q = nil
+	w.ev.mu.Unlock()
+
+	var removed []uint64
+	for j, alive := range prev.Alive {
+		id := pack(uint32(j), prev.Gens[j])
+		if alive && !w.alloc.isAlive(id) {
+			removed = append(removed, id)
+		}
+	}
+	w.mu.Unlock()
+
+	s := w.Systems()
+	for _, id := range removed {
+		for _, sys := range s {
+			sys.Remove(id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package core
+
+import "testing"
+
+type score struct{ N int }
+
+func TestRewind(t *testing.T) {
+	w := NewWorld(func(err error) { t.Error(err) })
+	w.Record(8)
+	es := w.NewEntitys(3)
+	w.Attach(es[0], pos{0})
+	w.Attach(es[1], pos{1})
+	if err := w.SetParent(es[1], es[0]); err != nil {
+		t.Fatal(err)
+	}
+	sc := &score{1}
+	w.InsertResource(sc)
+	withPos := w.Query().With(pos{})
+	withVel := w.Query().With(vel{})
+	w.Mark(1)
+
+	w.Attach(es[2], pos{2})
+	w.Attach(es[0], vel{1}, pos{10})
+	w.Despawn(es[1])
+	if err := w.SetParent(es[2], es[0]); err != nil {
+		t.Fatal(err)
+	}
+	sc.N = 5
+	w.Mark(2)
+	spawned := w.NewEntity()
+
+	if err := w.Rewind(1); err != nil {
+		t.Fatal(err)
+	}
+	if n := w.Len(); n != 3 {
+		t.Errorf("%d entities after rewinding, expected 3", n)
+	}
+	if !w.IsAlive(es[1]) {
+		t.Error("despawned entity not restored")
+	}
+	if w.IsAlive(spawned) {
+		t.Error("entity spawned after the recorded step still alive")
+	}
+	if n := withPos.Len(); n != 2 {
+		t.Errorf("%d entities with pos after rewinding, expected 2", n)
+	}
+	if n := withVel.Len(); n != 0 {
+		t.Errorf("%d entities with vel after rewinding, expected 0", n)
+	}
+	if c, ok := w.Component(es[0], pos{}); !ok || c.(pos).X != 0 {
+		t.Errorf("pos of entity 0 is %v after rewinding, expected {0}", c)
+	}
+	if w.Has(es[2], pos{}) {
+		t.Error("component attached after the recorded step still attached")
+	}
+	if p, ok := w.Parent(es[1]); !ok || p != es[0] {
+		t.Error("parent of a despawned child not restored")
+	}
+	if _, ok := w.Parent(es[2]); ok {
+		t.Error("entity reparented after the recorded step still parented")
+	}
+	if cs := w.Children(es[0]); len(cs) != 1 || cs[0] != es[1] {
+		t.Errorf("children %v after rewinding, expected [%v]", cs, es[1])
+	}
+	r, err := w.Resource((*score)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != sc || sc.N != 1 {
+		t.Errorf("score resource is %v after rewinding, expected the same pointer at 1", r)
+	}
+	if w.Recorded(2) {
+		t.Error("step after the rewound step still recorded")
+	}
+	if err := w.Rewind(2); err == nil {
+		t.Error("rewound to a dropped step")
+	}
+}
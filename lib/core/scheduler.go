@@ -0,0 +1,166 @@
+package core
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Accessor is implemented by systems declaring the component types they read
+// and write during Update. Systems that do not implement Accessor are assumed
+// to touch everything and never run alongside another system. Component types
+// used only as query filters count as reads, and world resources may be
+// declared by their type in the same way as components.
+type Accessor interface {
+	Reads() []Component
+	Writes() []Component
+}
+
+type access struct {
+	exclusive bool
+	reads     map[reflect.Type]bool
+	writes    map[reflect.Type]bool
+}
+
+func accessOf(s System) access {
+	a, ok := s.(Accessor)
+	if !ok {
+		return access{exclusive: true}
+	}
+	ret := access{
+		reads:  make(map[reflect.Type]bool),
+		writes: make(map[reflect.Type]bool),
+	}
+	for _, c := range a.Reads() {
+		ret.reads[typeOf(c)] = true
+	}
+	for _, c := range a.Writes() {
+		ret.writes[typeOf(c)] = true
+	}
+	return ret
+}
+
+func (a access) conflicts(b access) bool {
+	if a.exclusive || b.exclusive {
+		return true
+	}
+	for t := range a.writes {
+		if b.reads[t] || b.writes[t] {
+			return true
+		}
+	}
+	for t := range b.writes {
+		if a.reads[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// graph orders a list of systems so that any two conflicting or explicitly
+// ordered systems run in list order, while other systems may run at once.
+type graph struct {
+	next  [][]int // systems that must wait on system i
+	waits []int   // number of systems system i waits on
+	roots []int
+}
+
+func newGraph(s []System) *graph {
+	g := &graph{
+		next:  make([][]int, len(s)),
+		waits: make([]int, len(s)),
+	}
+	ordered := orderedPairs(s)
+	acc := make([]access, len(s))
+	for j := range s {
+		acc[j] = accessOf(s[j])
+		for i := 0; i < j; i++ {
+			if ordered[[2]int{i, j}] || acc[i].conflicts(acc[j]) {
+				g.next[i] = append(g.next[i], j)
+				g.waits[j]++
+			}
+		}
+		if g.waits[j] == 0 {
+			g.roots = append(g.roots, j)
+		}
+	}
+	return g
+}
+
+// orderedPairs returns the pairs of positions in an already ordered list that
+// are directly constrained by Orderer declarations.
+func orderedPairs(s []System) map[[2]int]bool {
+	byName := make(map[string]int)
+	for i, sys := range s {
+		if n, ok := sys.(Namer); ok {
+			byName[n.Name()] = i
+		}
+	}
+	ret := make(map[[2]int]bool)
+	for i, sys := range s {
+		o, ok := sys.(Orderer)
+		if !ok {
+			continue
+		}
+		for _, n := range o.After() {
+			if j, ok := byName[n]; ok {
+				ret[[2]int{j, i}] = true
+			}
+		}
+		for _, n := range o.Before() {
+			if j, ok := byName[n]; ok {
+				ret[[2]int{i, j}] = true
+			}
+		}
+	}
+	return ret
+}
+
+// run calls update for the position of every system of the list the graph was
+// built from on a pool of workers, returning errors indexed by system position.
+func (g *graph) run(workers int, s []System, update func(int) error) []error {
+	errs := make([]error, len(s))
+	if workers <= 1 || len(s) < 2 {
+		for i := range s {
+			errs[i] = update(i)
+		}
+		return errs
+	}
+
+	waits := make([]int, len(s))
+	copy(waits, g.waits)
+
+	var mu sync.Mutex
+	ready := make(chan int, len(s))
+	for _, i := range g.roots {
+		ready <- i
+	}
+	done := 0
+
+	if workers > len(s) {
+		workers = len(s)
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for n := 0; n < workers; n++ {
+		go func() {
+			defer wg.Done()
+			for i := range ready {
+				errs[i] = update(i)
+				mu.Lock()
+				for _, j := range g.next[i] {
+					waits[j]--
+					if waits[j] == 0 {
+						ready <- j
+					}
+				}
+				done++
+				if done == len(s) {
+					close(ready)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/step"
+)
+
+type pos struct{ X int }
+
+type vel struct{ X int }
+
+type testSystem struct {
+	name          string
+	reads, writes []Component
+	runs          int64
+	active        *int64 // systems running at once that write the same types
+}
+
+func (s *testSystem) Name() string        { return s.name }
+func (s *testSystem) Priority() int       { return 0 }
+func (s *testSystem) Remove(uint64)       {}
+func (s *testSystem) Reads() []Component  { return s.reads }
+func (s *testSystem) Writes() []Component { return s.writes }
+func (s *testSystem) Update(*step.Step) error {
+	atomic.AddInt64(&s.runs, 1)
+	if s.active != nil {
+		if n := atomic.AddInt64(s.active, 1); n > 1 {
+			return fmt.Errorf("%s ran alongside a conflicting system", s.name)
+		}
+		time.Sleep(10 * time.Microsecond)
+		atomic.AddInt64(s.active, -1)
+	}
+	return nil
+}
+
+// updating updates the world on another goroutine for the provided duration,
+// calling fn meanwhile, and fails if an update does not return.
+func updating(t *testing.T, w World, d time.Duration, fn func()) {
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		s := step.New(time.Hour, 0)
+		defer s.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			s.Increment(1)
+			w.Update(s)
+		}
+	}()
+	for end := time.Now().Add(d); time.Now().Before(end); {
+		fn()
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("world update did not return")
+	}
+}
+
+func TestSchedulerConflicts(t *testing.T) {
+	var errs []error
+	var mu sync.Mutex
+	w := NewWorld(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	w.SetWorkers(4)
+	var writingPos int64
+	ss := []*testSystem{
+		{name: "a", writes: []Component{pos{}}, active: &writingPos},
+		{name: "b", writes: []Component{pos{}}, active: &writingPos},
+		{name: "c", reads: []Component{vel{}}},
+		{name: "d", reads: []Component{vel{}}},
+		{name: "e", writes: []Component{pos{}}, active: &writingPos},
+	}
+	for _, s := range ss {
+		if err := w.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	updating(t, w, 200*time.Millisecond, func() { time.Sleep(time.Millisecond) })
+	for _, err := range errs {
+		t.Error(err)
+	}
+	for _, s := range ss[1:] {
+		if s.runs != ss[0].runs {
+			t.Errorf("system %s ran %d times, expected %d", s.name, s.runs, ss[0].runs)
+		}
+	}
+}
+
+func TestSchedulerConcurrentChanges(t *testing.T) {
+	w := NewWorld(func(err error) { t.Error(err) })
+	w.SetWorkers(4)
+	for _, n := range []string{"a", "b", "c", "d"} {
+		if err := w.Add(&testSystem{name: n, reads: []Component{pos{}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	updating(t, w, time.Second, func() {
+		w.DisableSystem("b")
+		w.Add(&testSystem{name: "e", writes: []Component{vel{}}})
+		w.EnableSystem("b")
+		w.RemoveSystem("e")
+	})
+}
+
+// toggler disables or enables another system of its stage every other time it
+// is handed its commands, between the stage capturing its systems and running
+// them.
+type toggler struct {
+	testSystem
+	w      World
+	target string
+	calls  int
+}
+
+func (s *toggler) SetCommands(*Commands) {
+	s.calls++
+	switch {
+	case s.calls%2 == 0:
+	case s.w.Enabled(s.target):
+		s.w.DisableSystem(s.target)
+	default:
+		s.w.EnableSystem(s.target)
+	}
+}
+
+func TestSchedulerChangeDuringUpdate(t *testing.T) {
+	w := NewWorld(func(err error) { t.Error(err) })
+	w.SetWorkers(4)
+	for _, n := range []string{"a", "b", "c"} {
+		if err := w.Add(&testSystem{name: n, reads: []Component{pos{}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tg := &toggler{testSystem: testSystem{name: "toggler", reads: []Component{pos{}}}, w: w, target: "b"}
+	if err := w.Add(tg); err != nil {
+		t.Fatal(err)
+	}
+	updating(t, w, 100*time.Millisecond, func() { time.Sleep(time.Millisecond) })
+}
+
+type tag struct{}
+
+// withoutIterator iterates a query requiring no component, whose matching set
+// is re-evaluated on every component change, yielding to other systems on
+// every entity.
+type withoutIterator struct {
+	testSystem
+	w World
+}
+
+func (s *withoutIterator) Update(*step.Step) error {
+	s.w.Query().Without(tag{}).Each(func(Entity) { runtime.Gosched() })
+	return nil
+}
+
+// posToggler detaches pos from its entities on even steps, leaving them
+// without components and so out of every matching set, and attaches it on odd
+// steps.
+type posToggler struct {
+	testSystem
+	w  World
+	es []Entity
+}
+
+func (s *posToggler) Update(st *step.Step) error {
+	for _, e := range s.es {
+		if int(st.Value)%2 == 0 {
+			s.w.Detach(e, pos{})
+		} else {
+			s.w.Attach(e, pos{})
+		}
+	}
+	return nil
+}
+
+func TestSchedulerIterateWhileChanging(t *testing.T) {
+	w := NewWorld(func(err error) { t.Error(err) })
+	w.SetWorkers(4)
+	es := w.NewEntitys(64)
+	for _, e := range es {
+		w.Attach(e, pos{})
+	}
+	err := w.Add(
+		&withoutIterator{testSystem{name: "iterate", reads: []Component{tag{}}}, w},
+		&posToggler{testSystem{name: "toggle", writes: []Component{pos{}}}, w, es},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updating(t, w, 200*time.Millisecond, func() { time.Sleep(time.Millisecond) })
+}
@@ -0,0 +1,392 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Save.
+const SnapshotVersion = 1
+
+// Encoding selects the format of a world snapshot.
+type Encoding int
+
+const (
+	// Binary is a compact gob based encoding.
+	Binary Encoding = iota
+	// JSON is a readable encoding, mainly for debugging.
+	JSON
+)
+
+// Clock is the engine timing saved alongside a world snapshot.
+type Clock struct {
+	Step     float64
+	LastTick float64
+}
+
+var (
+	snapshotMagic = []byte("HOLO")
+
+	unregisteredTypeError = xrr.Xrror("type %s is not registered").Out
+	unknownTypeError      = xrr.Xrror("snapshot type %s is not registered").Out
+	snapshotVersionError  = xrr.Xrror("unsupported snapshot version %d").Out
+	snapshotFormatError   = xrr.Xrror("malformed snapshot: %s").Out
+)
+
+type snapshot struct {
+	Version   int
+	Clock     Clock
+	Allocator allocatorState
+	Stores    []storeState
+	Links     []link
+	Resources []value
+}
+
+type allocatorState struct {
+	Gens  []uint32
+	Alive []bool
+	Free  []uint32
+}
+
+type storeState struct {
+	Type string
+	IDs  []uint64
+	Data []json.RawMessage
+}
+
+type link struct {
+	Child, Parent uint64
+}
+
+type value struct {
+	Type string
+	Data json.RawMessage
+}
+
+type codec struct {
+	marshal   func(interface{}) ([]byte, error)
+	unmarshal func([]byte, interface{}) error
+}
+
+func codecFor(enc Encoding) codec {
+	if enc == JSON {
+		return codec{json.Marshal, json.Unmarshal}
+	}
+	return codec{gobMarshal, gobUnmarshal}
+}
+
+// gobbable reports whether gob is able to encode values of the type, gob
+// refusing types without exported fields such as empty tag components.
+func gobbable(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func gobMarshal(v interface{}) ([]byte, error) {
+	if !gobbable(reflect.TypeOf(v)) {
+		return nil, nil
+	}
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(v)
+	return b.Bytes(), err
+}
+
+func gobUnmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (c codec) decode(t reflect.Type, data []byte) (interface{}, error) {
+	ptr := reflect.New(t)
+	if len(data) > 0 {
+		if err := c.unmarshal(data, ptr.Interface()); err != nil {
+			return nil, err
+		}
+	}
+	v := ptr.Elem()
+	if t.Kind() == reflect.Ptr && v.IsNil() {
+		v.Set(reflect.New(t.Elem()))
+	}
+	return v.Interface(), nil
+}
+
+func (a *allocator) state() allocatorState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return allocatorState{
+		Gens:  append([]uint32{}, a.gens...),
+		Alive: append([]bool{}, a.alive...),
+		Free:  append([]uint32{}, a.free...),
+	}
+}
+
+func (a *allocator) restore(s allocatorState) error {
+	if len(s.Gens) != len(s.Alive) {
+		return snapshotFormatError("allocator generations and liveness differ in length")
+	}
+	live := 0
+	for _, v := range s.Alive {
+		if v {
+			live++
+		}
+	}
+	for _, i := range s.Free {
+		if int(i) >= len(s.Gens) || s.Alive[i] {
+			return snapshotFormatError("allocator free list holds a live or unknown slot")
+		}
+	}
+	a.mu.Lock()
+	a.gens, a.alive, a.free, a.live = s.Gens, s.Alive, s.Free, live
+	a.dirty = true
+	a.mu.Unlock()
+	return nil
+}
+
+func (w *world) snapshot(c codec, clock Clock) (*snapshot, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	snap := &snapshot{
+		Version:   SnapshotVersion,
+		Clock:     clock,
+		Allocator: w.alloc.state(),
+	}
+
+	for _, s := range w.cmp.byBit {
+		if s.len() == 0 {
+			continue
+		}
+		name, ok := w.reg.nameOf(s.typ)
+		if !ok {
+			return nil, unregisteredTypeError(s.typ)
+		}
+		st := storeState{
+			Type: name,
+			IDs:  append([]uint64{}, s.ids...),
+			Data: make([]json.RawMessage, len(s.data)),
+		}
+		for i, cmp := range s.data {
+			data, err := c.marshal(cmp)
+			if err != nil {
+				return nil, err
+			}
+			st.Data[i] = data
+		}
+		snap.Stores = append(snap.Stores, st)
+	}
+
+	var parents []uint64
+	for p := range w.h.children {
+		parents = append(parents, p)
+	}
+	sort.Slice(parents, func(i, j int) bool { return parents[i] < parents[j] })
+	for _, p := range parents {
+		for _, child := range w.h.children[p] {
+			snap.Links = append(snap.Links, link{child, p})
+		}
+	}
+
+	w.rs.mu.RLock()
+	defer w.rs.mu.RUnlock()
+	for _, name := range w.reg.names() {
+		t, _ := w.reg.typeOf(name)
+		r, ok := w.rs.m[t]
+		if !ok {
+			continue
+		}
+		data, err := c.marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		snap.Resources = append(snap.Resources, value{name, data})
+	}
+
+	return snap, nil
+}
+
+// Save writes the entities, components, hierarchy, registered resources and
+// allocator state of the world along with the provided clock. Every component
+// type present must be registered; resources of unregistered types are not
+// saved.
+func (w *world) Save(wr io.Writer, enc Encoding, clock Clock) error {
+	snap, err := w.snapshot(codecFor(enc), clock)
+	if err != nil {
+		return err
+	}
+
+	if enc == JSON {
+		e := json.NewEncoder(wr)
+		e.SetIndent("", "  ")
+		return e.Encode(snap)
+	}
+
+	if _, err = wr.Write(snapshotMagic); err != nil {
+		return err
+	}
+	if err = binary.Write(wr, binary.BigEndian, uint16(SnapshotVersion)); err != nil {
+		return err
+	}
+	return gob.NewEncoder(wr).Encode(snap)
+}
+
+func readSnapshot(r io.Reader) (*snapshot, Encoding, error) {
+	br := bufio.NewReader(r)
+	snap := new(snapshot)
+
+	head, _ := br.Peek(len(snapshotMagic))
+	if !bytes.Equal(head, snapshotMagic) {
+		if err := json.NewDecoder(br).Decode(snap); err != nil {
+			return nil, JSON, snapshotFormatError(err)
+		}
+		return snap, JSON, nil
+	}
+
+	br.Discard(len(snapshotMagic))
+	var version uint16
+	if err := binary.Read(br, binary.BigEndian, &version); err != nil {
+		return nil, Binary, snapshotFormatError(err)
+	}
+	if version != SnapshotVersion {
+		return nil, Binary, snapshotVersionError(version)
+	}
+	if err := gob.NewDecoder(br).Decode(snap); err != nil {
+		return nil, Binary, snapshotFormatError(err)
+	}
+	return snap, Binary, nil
+}
+
+type decodedStore struct {
+	typ  reflect.Type
+	ids  []uint64
+	data []Component
+}
+
+// Load replaces the entities, components, hierarchy and allocator state of the
+// world, along with any saved resources, with those read from a snapshot in
+// either encoding, returning the saved clock. Systems are kept and informed of
+// entities no longer alive. The world is left unchanged if the snapshot cannot
+// be read.
+func (w *world) Load(r io.Reader) (Clock, error) {
+	snap, enc, err := readSnapshot(r)
+	if err != nil {
+		return Clock{}, err
+	}
+	if snap.Version != SnapshotVersion {
+		return Clock{}, snapshotVersionError(snap.Version)
+	}
+	removed, err := w.restore(snap, codecFor(enc))
+	if err != nil {
+		return Clock{}, err
+	}
+
+	s := w.Systems()
+	for _, id := range removed {
+		for _, sys := range s {
+			sys.Remove(id)
+		}
+	}
+	return snap.Clock, nil
+}
+
+// restore applies a snapshot, returning the ids alive before but not after.
+func (w *world) restore(snap *snapshot, c codec) ([]uint64, error) {
+	stores := make([]decodedStore, len(snap.Stores))
+	for i, st := range snap.Stores {
+		t, ok := w.reg.typeOf(st.Type)
+		if !ok {
+			return nil, unknownTypeError(st.Type)
+		}
+		if len(st.IDs) != len(st.Data) {
+			return nil, snapshotFormatError("store " + st.Type + " ids and data differ in length")
+		}
+		ds := decodedStore{typ: t, ids: st.IDs, data: make([]Component, len(st.Data))}
+		for j, data := range st.Data {
+			v, err := c.decode(t, data)
+			if err != nil {
+				return nil, snapshotFormatError(err)
+			}
+			ds.data[j] = v
+		}
+		stores[i] = ds
+	}
+
+	res := make([]interface{}, len(snap.Resources))
+	for i, v := range snap.Resources {
+		t, ok := w.reg.typeOf(v.Type)
+		if !ok {
+			return nil, unknownTypeError(v.Type)
+		}
+		r, err := c.decode(t, v.Data)
+		if err != nil {
+			return nil, snapshotFormatError(err)
+		}
+		res[i] = r
+	}
+
+	next := newAllocator()
+	if err := next.restore(snap.Allocator); err != nil {
+		return nil, err
+	}
+	for _, ds := range stores {
+		for _, id := range ds.ids {
+			if !next.isAlive(id) {
+				return nil, snapshotFormatError("component held by an entity that is not alive")
+			}
+		}
+	}
+	for _, l := range snap.Links {
+		if !next.isAlive(l.Child) || !next.isAlive(l.Parent) {
+			return nil, snapshotFormatError("hierarchy link between entities that are not alive")
+		}
+	}
+
+	w.mu.Lock()
+	prev := w.alloc.state()
+	for id := range w.cmp.entities {
+		for _, s := range w.cmp.clear(id) {
+			w.qs.touched(id, s, nil)
+		}
+	}
+	w.h = newHierarchy()
+	w.alloc.restore(snap.Allocator)
+	tick := w.nextTick()
+	for _, ds := range stores {
+		for j, id := range ds.ids {
+			if s, added := w.cmp.attach(id, ds.data[j], tick); added {
+				w.qs.touched(id, s, w.cmp.entities[id])
+			}
+		}
+	}
+	for _, l := range snap.Links {
+		w.h.link(l.Child, l.Parent)
+	}
+	w.mu.Unlock()
+
+	w.InsertResource(res...)
+
+	var removed []uint64
+	for i, alive := range prev.Alive {
+		id := pack(uint32(i), prev.Gens[i])
+		if alive && !w.alloc.isAlive(id) {
+			removed = append(removed, id)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"sync/atomic"
+
+	"github.com/Laughs-In-Flowers/holo/lib/util/step"
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+// The built in stages, run in this order every world update.
+const (
+	StagePreUpdate  = "PreUpdate"
+	StageUpdate     = "Update"
+	StagePostUpdate = "PostUpdate"
+	StageRender     = "Render"
+)
+
+// Stager is implemented by systems assigned to a stage other than StageUpdate.
+type Stager interface {
+	Stage() string
+}
+
+// Cadence reports whether a stage runs for the provided step. A stage without
+// a cadence runs on every step.
+type Cadence func(*step.Step) bool
+
+// Every returns a Cadence running a stage on every nth step.
+func Every(n int) Cadence {
+	var count int
+	return func(*step.Step) bool {
+		count++
+		if count >= n {
+			count = 0
+			return true
+		}
+		return false
+	}
+}
+
+var (
+	unknownStageError   = xrr.Xrror("unknown stage %s").Out
+	duplicateStageError = xrr.Xrror("stage %s is already present").Out
+	stageOrderError     = xrr.Xrror("system %s of stage %s must run %s system %s of stage %s").Out
+)
+
+type stage struct {
+	name    string
+	cadence Cadence
+	systems systems
+	active  systems
+	cmds    []*Commands
+	ran     []uint64 // change tick at the start of the last run, accessed atomically
+	g       *graph   // execution graph of active
+	workers int
+}
+
+// activate rebuilds the list of systems run by the stage, along with a command
+// buffer for each system implementing Commander and their execution graph. Systems that remain active
+// keep the change tick of their last run.
+func (st *stage) activate(w *world) {
+	last := make(map[string]uint64, len(st.active))
+	for i, sys := range st.active {
+		last[systemName(sys)] = atomic.LoadUint64(&st.ran[i])
+	}
+	st.active = make(systems, 0, len(st.systems))
+	st.cmds = make([]*Commands, 0, len(st.systems))
+	st.ran = make([]uint64, 0, len(st.systems))
+	for _, sys := range st.systems {
+		name := systemName(sys)
+		if w.disabled[name] {
+			continue
+		}
+		st.active = append(st.active, sys)
+		var c *Commands
+		if _, ok := sys.(Commander); ok {
+			c = newCommands(w)
+		}
+		st.cmds = append(st.cmds, c)
+		st.ran = append(st.ran, last[name])
+	}
+	st.g = newGraph(st.active)
+}
+
+func newStage(name string, workers int) *stage {
+	return &stage{
+		name:    name,
+		g:       newGraph(nil),
+		workers: workers,
+	}
+}
+
+func defaultStages(workers int) []*stage {
+	return []*stage{
+		newStage(StagePreUpdate, workers),
+		newStage(StageUpdate, workers),
+		newStage(StagePostUpdate, workers),
+		newStage(StageRender, workers),
+	}
+}
+
+func stageOf(s System) string {
+	if st, ok := s.(Stager); ok {
+		return st.Stage()
+	}
+	return StageUpdate
+}
+
+func (w *world) stage(name string) (int, *stage) {
+	for i, st := range w.stages {
+		if st.name == name {
+			return i, st
+		}
+	}
+	return -1, nil
+}
+
+// AddStage adds a stage running directly after the named stage, or after every
+// other stage when after is empty.
+func (w *world) AddStage(name, after string) error {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	if i, _ := w.stage(name); i >= 0 {
+		return duplicateStageError(name)
+	}
+	at := len(w.stages)
+	if after != "" {
+		i, _ := w.stage(after)
+		if i < 0 {
+			return unknownStageError(after)
+		}
+		at = i + 1
+	}
+	st := newStage(name, w.workers)
+	w.stages = append(w.stages[:at], append([]*stage{st}, w.stages[at:]...)...)
+	return nil
+}
+
+// SetCadence sets the cadence of the named stage, a nil cadence runs the stage
+// on every step.
+func (w *world) SetCadence(name string, c Cadence) error {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	_, st := w.stage(name)
+	if st == nil {
+		return unknownStageError(name)
+	}
+	st.cadence = c
+	return nil
+}
+
+// Stages returns the names of every stage in the order they run.
+func (w *world) Stages() []string {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	ret := make([]string, len(w.stages))
+	for i, st := range w.stages {
+		ret[i] = st.name
+	}
+	return ret
+}
@@ -0,0 +1,62 @@
+package core
+
+// Key names an event carrying payloads of type T, so that publishers and
+// subscribers using the key are checked by the compiler. Keys share the name
+// space of the string API: a Key[T] named "x" publishes and receives events
+// dispatched as "x".
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns the key of the named event carrying payloads of type T.
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name}
+}
+
+// Name returns the event name of the key.
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Typed keys of the structural events dispatched by a World.
+var (
+	Spawned          = NewKey[EntityEvent](OnSpawn)
+	Despawned        = NewKey[EntityEvent](OnDespawn)
+	ComponentAdded   = NewKey[ComponentEvent](OnComponentAdd)
+	ComponentChanged = NewKey[ComponentEvent](OnComponentChange)
+	ComponentRemoved = NewKey[ComponentEvent](OnComponentRemove)
+)
+
+// Publish dispatches v to the subscribers of the key, returning true if the
+// dispatch was cancelled.
+func Publish[T any](d Dispatcher, k Key[T], v T) bool {
+	return d.Dispatch(k.name, v)
+}
+
+// PublishQueued enqueues v for the next flush, returning false if a full queue
+// discarded it.
+func PublishQueued[T any](d Dispatcher, k Key[T], v T) bool {
+	return d.Enqueue(k.name, v)
+}
+
+// On subscribes fn to the events of the key. The id may be used to
+// unsubscribe with Off. Payloads of another type, dispatched through the
+// string API under the same name, are not handed to fn.
+func On[T any](d Dispatcher, k Key[T], id interface{}, fn func(T)) *Subscription {
+	return OnEvent(d, k, id, func(v T, _ *Event) { fn(v) })
+}
+
+// OnEvent is On for subscribers needing the Event, e.g. to cancel it.
+func OnEvent[T any](d Dispatcher, k Key[T], id interface{}, fn func(T, *Event)) *Subscription {
+	return d.SubscribeEvent(k.name, id, func(ev *Event) {
+		if v, ok := ev.Data.(T); ok {
+			fn(v, ev)
+		}
+	})
+}
+
+// Off unsubscribes every subscription of the key with the provided id,
+// returning the number found.
+func Off[T any](d Dispatcher, k Key[T], id interface{}) int {
+	return d.UnsubscribeID(k.name, id)
+}
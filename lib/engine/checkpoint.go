@@ -0,0 +1,273 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+	"github.com/Laughs-In-Flowers/holo/lib/util/step"
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+// CheckpointPolicy describes when and where the engine checkpoints the world.
+// A checkpoint is written every Ticks world updates, every Interval of wall
+// time, or whichever comes first when both are set. Only the newest Keep
+// checkpoints are kept.
+type CheckpointPolicy struct {
+	Dir      string
+	Ticks    int
+	Interval time.Duration
+	Keep     int
+	Encoding core.Encoding
+}
+
+const (
+	checkpointPrefix = "checkpoint-"
+	checkpointSuffix = ".holo"
+)
+
+// A checkpoint file is a world snapshot followed by a trailer holding the
+// snapshot length, its CRC32 checksum and a magic value, so that truncated or
+// otherwise damaged files are detected before loading.
+var checkpointMagic = []byte("HCKP")
+
+const checkpointTrailer = 8 + 4 + 4
+
+var (
+	corruptCheckpointError = xrr.Xrror("checkpoint %s is corrupt: %s").Out
+	noCheckpointError      = xrr.Xrror("no valid checkpoint in %s").Out
+)
+
+func checkpointName(seq uint64) string {
+	return fmt.Sprintf("%s%020d%s", checkpointPrefix, seq, checkpointSuffix)
+}
+
+// checkpoints returns the checkpoint files of dir with their sequence numbers,
+// newest first.
+func checkpoints(dir string) ([]string, []uint64, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	type cp struct {
+		name string
+		seq  uint64
+	}
+	var found []cp
+	for _, fi := range infos {
+		n := fi.Name()
+		if fi.IsDir() || !strings.HasPrefix(n, checkpointPrefix) || !strings.HasSuffix(n, checkpointSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(n, checkpointPrefix), checkpointSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		found = append(found, cp{n, seq})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].seq > found[j].seq })
+	names := make([]string, len(found))
+	seqs := make([]uint64, len(found))
+	for i, c := range found {
+		names[i] = filepath.Join(dir, c.name)
+		seqs[i] = c.seq
+	}
+	return names, seqs, nil
+}
+
+// writeCheckpoint atomically writes a checkpoint of the world to path.
+func writeCheckpoint(path string, w core.World, enc core.Encoding, c core.Clock) error {
+	var b bytes.Buffer
+	if err := w.Save(&b, enc, c); err != nil {
+		return err
+	}
+	var trailer [checkpointTrailer]byte
+	binary.BigEndian.PutUint64(trailer[0:8], uint64(b.Len()))
+	binary.BigEndian.PutUint32(trailer[8:12], crc32.ChecksumIEEE(b.Bytes()))
+	copy(trailer[12:], checkpointMagic)
+	b.Write(trailer[:])
+
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b.Bytes()); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// readCheckpoint returns the verified snapshot held by a checkpoint file.
+func readCheckpoint(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < checkpointTrailer {
+		return nil, corruptCheckpointError(path, "too short")
+	}
+	trailer := data[len(data)-checkpointTrailer:]
+	payload := data[:len(data)-checkpointTrailer]
+	switch {
+	case !bytes.Equal(trailer[12:], checkpointMagic):
+		return nil, corruptCheckpointError(path, "missing trailer")
+	case binary.BigEndian.Uint64(trailer[0:8]) != uint64(len(payload)):
+		return nil, corruptCheckpointError(path, "length mismatch")
+	case binary.BigEndian.Uint32(trailer[8:12]) != crc32.ChecksumIEEE(payload):
+		return nil, corruptCheckpointError(path, "checksum mismatch")
+	}
+	return payload, nil
+}
+
+type checkpointer struct {
+	CheckpointPolicy
+	seq   uint64
+	ticks int
+	last  time.Time
+}
+
+func newCheckpointer(p CheckpointPolicy) (*checkpointer, error) {
+	if p.Keep < 1 {
+		p.Keep = 1
+	}
+	if err := os.MkdirAll(p.Dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &checkpointer{CheckpointPolicy: p, last: time.Now()}
+	_, seqs, err := checkpoints(p.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(seqs) > 0 {
+		c.seq = seqs[0]
+	}
+	return c, nil
+}
+
+func (c *checkpointer) due() bool {
+	c.ticks++
+	switch {
+	case c.Ticks > 0 && c.ticks >= c.Ticks:
+		return true
+	case c.Interval > 0 && time.Since(c.last) >= c.Interval:
+		return true
+	}
+	return false
+}
+
+func (c *checkpointer) tick(e *Engine, s *step.Step) {
+	if !c.due() {
+		return
+	}
+	c.ticks = 0
+	c.last = time.Now()
+	c.seq++
+	path := filepath.Join(c.Dir, checkpointName(c.seq))
+	if err := writeCheckpoint(path, e.World, c.Encoding, core.Clock{Step: s.Value, LastTick: s.Value}); err != nil {
+		e.HandleWarning(err)
+		return
+	}
+	c.rotate(e)
+}
+
+func (c *checkpointer) rotate(e *Engine) {
+	names, _, err := checkpoints(c.Dir)
+	if err != nil {
+		e.HandleWarning(err)
+		return
+	}
+	for i := c.Keep; i < len(names); i++ {
+		if err := os.Remove(names[i]); err != nil {
+			e.HandleWarning(err)
+		}
+	}
+}
+
+// Resume loads the newest valid checkpoint from dir, skipping corrupt or
+// unreadable checkpoints, and returns the path loaded.
+func (e *Engine) Resume(dir string) (string, error) {
+	path, ok, err := e.resume(dir)
+	if err == nil && !ok {
+		err = noCheckpointError(dir)
+	}
+	return path, err
+}
+
+// resume loads the newest valid checkpoint from dir, returning false if dir
+// holds none.
+func (e *Engine) resume(dir string) (string, bool, error) {
+	names, _, err := checkpoints(dir)
+	if err != nil {
+		return "", false, err
+	}
+	for _, path := range names {
+		payload, err := readCheckpoint(path)
+		if err == nil {
+			err = e.load(bytes.NewReader(payload))
+		}
+		if err != nil {
+			e.HandleWarning(err)
+			continue
+		}
+		return path, true, nil
+	}
+	return "", false, nil
+}
+
+func SetCheckpoint(p CheckpointPolicy) Config {
+	return NewConfig(560,
+		func(e *Engine) error {
+			c, err := newCheckpointer(p)
+			if err != nil {
+				return err
+			}
+			e.SetTick(c.tick)
+			r.Add(fmt.Sprintf("checkpointing to %s every %d ticks / %s, keeping %d", p.Dir, p.Ticks, p.Interval, c.Keep))
+			return nil
+		})
+}
+
+// ResumeCheckpoint resumes from the newest valid checkpoint of dir, starting
+// afresh when dir is missing or holds no valid checkpoint. It is configured
+// after LoadSnapshot, a checkpoint found replacing any snapshot loaded.
+func ResumeCheckpoint(dir string) Config {
+	return NewConfig(551,
+		func(e *Engine) error {
+			path, ok, err := e.resume(dir)
+			switch {
+			case os.IsNotExist(err):
+				r.Add(fmt.Sprintf("no checkpoint directory %s, starting afresh", dir))
+			case err != nil:
+				return err
+			case !ok:
+				r.Add(noCheckpointError(dir).Error() + ", starting afresh")
+			default:
+				r.Add(fmt.Sprintf("resumed from checkpoint %s at step %f", path, e.TickInit))
+			}
+			return nil
+		})
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+	"github.com/Laughs-In-Flowers/holo/lib/util/step"
+)
+
+type health struct{ N int }
+
+// checkpointEngine returns an engine with n entities holding health.
+func checkpointEngine(t *testing.T, n int) *Engine {
+	t.Helper()
+	e := newEngine(t, RegisterType("health", health{}))
+	for i, ent := range e.World.NewEntitys(n) {
+		e.World.Attach(ent, health{i})
+	}
+	return e
+}
+
+func writeTestCheckpoint(t *testing.T, e *Engine, dir string, seq uint64) string {
+	t.Helper()
+	path := filepath.Join(dir, checkpointName(seq))
+	if err := writeCheckpoint(path, e.World, core.Binary, core.Clock{Step: float64(seq)}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadCheckpointCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestCheckpoint(t, checkpointEngine(t, 3), dir, 1)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCheckpoint(path); err != nil {
+		t.Fatalf("valid checkpoint rejected: %s", err)
+	}
+
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)/2] ^= 0xff
+	for name, damaged := range map[string][]byte{
+		"truncated":       data[:len(data)-5],
+		"truncated short": data[:checkpointTrailer-1],
+		"flipped byte":    flipped,
+		"no trailer":      data[:len(data)-checkpointTrailer],
+	} {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, damaged, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readCheckpoint(p); err == nil {
+			t.Errorf("%s checkpoint accepted", name)
+		}
+	}
+}
+
+func TestResumeSkipsCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCheckpoint(t, checkpointEngine(t, 2), dir, 1)
+	newest := writeTestCheckpoint(t, checkpointEngine(t, 5), dir, 2)
+	data, err := ioutil.ReadFile(newest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xff
+	if err := ioutil.WriteFile(newest, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := newEngine(t, RegisterType("health", health{}))
+	path, ok, err := e.resume(dir)
+	if err != nil || !ok {
+		t.Fatalf("resume returned %t, %v", ok, err)
+	}
+	if path != filepath.Join(dir, checkpointName(1)) {
+		t.Errorf("resumed from %s, expected the older checkpoint", path)
+	}
+	if n := e.World.Len(); n != 2 {
+		t.Errorf("resumed %d entities, expected 2", n)
+	}
+	if e.TickInit != 1 {
+		t.Errorf("resumed at step %f, expected 1", e.TickInit)
+	}
+}
+
+func TestResumeNoValidCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, checkpointName(1)), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := newEngine(t)
+	if _, ok, err := e.resume(dir); ok || err != nil {
+		t.Errorf("resume returned %t, %v, expected no checkpoint", ok, err)
+	}
+}
+
+func TestCheckpointRotate(t *testing.T) {
+	dir := t.TempDir()
+	e := checkpointEngine(t, 1)
+	c, err := newCheckpointer(CheckpointPolicy{Dir: dir, Ticks: 1, Keep: 2, Encoding: core.Binary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := step.New(time.Hour, 0)
+	defer s.Stop()
+	for i := 0; i < 5; i++ {
+		s.Increment(1)
+		c.tick(e, s)
+	}
+	names, seqs, err := checkpoints(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || seqs[0] != 5 || seqs[1] != 4 {
+		t.Errorf("kept checkpoints %v, expected 5 and 4", seqs)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(tmp) > 0 {
+		t.Errorf("temporary files left: %v", tmp)
+	}
+	if _, err := os.Stat(filepath.Join(dir, checkpointName(1))); !os.IsNotExist(err) {
+		t.Error("oldest checkpoint not removed")
+	}
+}
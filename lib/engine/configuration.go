@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Laughs-In-Flowers/holo/lib/core"
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
 	"github.com/Laughs-In-Flowers/log"
 )
 
@@ -180,13 +181,71 @@ func eError(e *Engine) error {
 
 func eWorld(e *Engine) error {
 	hefn := func(err error) {
-		e.hefn(e, err)
+		e.HandleError(err)
 	}
 	world := core.NewWorld(hefn)
+	world.Use(e.recoverer())
 	e.World = world
+	e.rw = newRewinder()
 	return nil
 }
 
+func SetWorkers(n int) Config {
+	return NewConfig(502,
+		func(e *Engine) error {
+			e.World.SetWorkers(n)
+			r.Add(fmt.Sprintf("world workers is %d", n))
+			return nil
+		})
+}
+
+func InsertResource(r ...interface{}) Config {
+	return NewConfig(502,
+		func(e *Engine) error {
+			e.World.InsertResource(r...)
+			return nil
+		})
+}
+
+func AddStage(name, after string) Config {
+	return NewConfig(502,
+		func(e *Engine) error {
+			return e.World.AddStage(name, after)
+		})
+}
+
+func SetStageCadence(name string, c core.Cadence) Config {
+	return NewConfig(503,
+		func(e *Engine) error {
+			return e.World.SetCadence(name, c)
+		})
+}
+
+func SetEventFlush(f FlushPoint) Config {
+	return NewConfig(50,
+		func(e *Engine) error {
+			e.EventFlush = f
+			r.Add(fmt.Sprintf("world events flushed %s", f))
+			return nil
+		})
+}
+
+var blockingQueueError = xrr.Xrror("world event queue cannot block, the engine enqueues and flushes on the same goroutine").Out
+
+// SetEventQueue bounds the world event queue. Only the drop policies are
+// accepted, a full queue blocking the update loop would never be flushed.
+func SetEventQueue(limit int, o core.Overflow) Config {
+	return NewConfig(502,
+		func(e *Engine) error {
+			if o == core.Block {
+				return blockingQueueError()
+			}
+			e.World.SetQueueLimit(limit, o)
+			r.Add(fmt.Sprintf("world event queue limited to %d", limit))
+			return nil
+		})
+}
+
 type MakeInner func(e *Engine, w core.World) Inner
 
 func eInner(e *Engine) error {
@@ -233,6 +292,15 @@ func SetTickValue(v float64) Config {
 		})
 }
 
+func SetMaxCatchUp(n int) Config {
+	return NewConfig(500,
+		func(e *Engine) error {
+			e.MaxCatchUp = n
+			r.Add(fmt.Sprintf("fixed step catch up is %d steps", n))
+			return nil
+		})
+}
+
 func SetLastTick(v float64) Config {
 	return NewConfig(500,
 		func(e *Engine) error {
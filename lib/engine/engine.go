@@ -1,8 +1,11 @@
 package engine
 
 import (
+	"math"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -19,6 +22,31 @@ type Settings struct {
 	TickIncr, TickInit, TickEnd float64
 	DebugReportStep             bool
 	DebugReportFrame            bool
+	EventFlush                  FlushPoint
+	MaxCatchUp                  int
+}
+
+// FlushPoint selects when in a tick the engine flushes events queued on the
+// world with Enqueue.
+type FlushPoint int
+
+const (
+	// FlushAfterUpdate flushes after every world update, the default.
+	FlushAfterUpdate FlushPoint = iota
+	// FlushBeforeUpdate flushes before every world update.
+	FlushBeforeUpdate
+	// FlushManual leaves flushing to the application.
+	FlushManual
+)
+
+func (f FlushPoint) String() string {
+	switch f {
+	case FlushBeforeUpdate:
+		return "before update"
+	case FlushManual:
+		return "manual"
+	}
+	return "after update"
 }
 
 func (s *Settings) resetSettings() {
@@ -26,6 +54,8 @@ func (s *Settings) resetSettings() {
 	s.TickDuration = 1 * time.Nanosecond
 	s.TickIncr = 1.0
 	s.TickInit = 0.0
+	s.EventFlush = FlushAfterUpdate
+	s.MaxCatchUp = 5
 }
 
 //
@@ -35,8 +65,12 @@ var defaultClose = []Close{
 	func(e *Engine) { e.Printf("last tick: %f", e.LastTick) },
 }
 
+// Tick is run after every world update of the engine.
+type Tick func(*Engine, *step.Step)
+
 //
 type State struct {
+	alpha    uint64
 	debug    bool
 	lock     bool
 	restart  bool
@@ -44,11 +78,15 @@ type State struct {
 	ChKill   chan struct{}
 	ChSys    chan os.Signal
 	close    []Close
+	tick     []Tick
+	step     *step.Step
 	LastTick float64
+	run      *runner
 }
 
 func newState() *State {
 	s := &State{
+		0,
 		false,
 		false,
 		false,
@@ -56,7 +94,10 @@ func newState() *State {
 		make(chan struct{}, 0),
 		make(chan os.Signal, 0),
 		defaultClose,
+		nil,
+		nil,
 		0,
+		newRunner(),
 	}
 
 	signal.Notify(
@@ -108,14 +149,98 @@ func (s *State) execClose(e *Engine) {
 	}
 }
 
+//
+func (s *State) SetTick(t ...Tick) {
+	s.tick = append(s.tick, t...)
+}
+
+func (s *State) execTick(e *Engine, st *step.Step) {
+	for _, v := range s.tick {
+		v(e, st)
+	}
+}
+
+// runner stops the inner loop of a running engine.
+type runner struct {
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	halt    chan struct{} // closed to stop the inner loop
+	halted  chan struct{} // closed once the inner loop returns
+}
+
+func newRunner() *runner {
+	return &runner{
+		halt:   make(chan struct{}),
+		halted: make(chan struct{}),
+	}
+}
+
+// start marks the inner loop as running, returning false if already stopped.
+func (r *runner) start() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return false
+	}
+	r.started = true
+	return true
+}
+
+// stop stops the inner loop, waiting for the step it is running to complete.
+func (r *runner) stop() {
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.halt)
+	}
+	started := r.started
+	r.mu.Unlock()
+	if started {
+		<-r.halted
+	}
+}
+
+// halting returns true once the inner loop is to stop.
+func (r *runner) halting() bool {
+	select {
+	case <-r.halt:
+		return true
+	default:
+		return false
+	}
+}
+
+// next waits for the next tick of the step, returning false once the inner
+// loop is to stop.
+func (r *runner) next(s *step.Step) bool {
+	select {
+	case <-r.halt:
+		return false
+	case <-s.C:
+		return !r.halting()
+	}
+}
+
+// signalKill asks for the engine to be closed, giving up once the inner loop is to
+// stop.
+func (e *Engine) signalKill() {
+	select {
+	case e.ChKill <- struct{}{}:
+	case <-e.run.halt:
+	}
+}
+
 type components struct {
 	inner Inner
 	World core.World
+	rw    *rewinder
 }
 
 //
 type Engine struct {
 	log.Logger
+	*core.Dsptchr
 	ErrorHandler
 	Configuration
 	Settings
@@ -126,11 +251,14 @@ type Engine struct {
 //
 func New(cnf ...Config) (*Engine, error) {
 	e := new(Engine)
+	e.Dsptchr = core.NewDispatcher()
+	e.Use(e.recoverer())
 	e.Configuration.Init(e, cnf...)
 	err := e.Configure()
 	if err != nil {
 		return nil, err
 	}
+	e.publish(OnConfigured)
 	return e, nil
 }
 
@@ -139,16 +267,19 @@ type Inner func()
 
 func NoDurationLimitInner(e *Engine, w core.World) Inner {
 	s := step.New(e.TickDuration, e.TickInit)
+	e.step = s
 	return func() {
-		for {
+		for !e.run.halting() {
 			s.Increment(e.TickIncr)
 			switch {
 			case e.lock:
 				// do nothing
+			case e.rw.pending():
+				e.rollback(w, s)
 			case e.kill:
-				e.ChKill <- struct{}{}
+				e.signalKill()
 			default:
-				w.Update(s)
+				e.tick(w, s)
 			}
 			killIf(e, s)
 		}
@@ -157,16 +288,19 @@ func NoDurationLimitInner(e *Engine, w core.World) Inner {
 
 func DefaultInner(e *Engine, w core.World) Inner {
 	s := step.New(e.TickDuration, e.TickInit)
+	e.step = s
 	return func() {
-		for range s.C {
+		for e.run.next(s) {
 			s.Increment(e.TickIncr)
 			switch {
 			case e.lock:
 				// do nothing
+			case e.rw.pending():
+				e.rollback(w, s)
 			case e.kill:
-				e.ChKill <- struct{}{}
+				e.signalKill()
 			default:
-				w.Update(s)
+				e.tick(w, s)
 			}
 			killIf(e, s)
 		}
@@ -177,8 +311,9 @@ func DebugInner(e *Engine, w core.World) Inner {
 	return func() {
 	RESTART:
 		s := step.New(e.TickDuration, e.TickInit)
+		e.step = s
 		f := DebugFrame()
-		for range s.C {
+		for e.run.next(s) {
 			s.Increment(e.TickIncr)
 			switch {
 			case e.lock:
@@ -186,12 +321,16 @@ func DebugInner(e *Engine, w core.World) Inner {
 			case e.restart:
 				e.restart = false
 				e.Print("restarting...")
+				e.publish(OnRestarting)
+				e.restarted(w)
 				goto RESTART
+			case e.rw.pending():
+				e.rollback(w, s)
 			case e.kill:
-				e.ChKill <- struct{}{}
+				e.signalKill()
 			default:
 				f.Start()
-				w.Update(s)
+				e.tick(w, s)
 				f.End()
 				e.DebugReport(f, s)
 			}
@@ -200,27 +339,109 @@ func DebugInner(e *Engine, w core.World) Inner {
 	}
 }
 
+// FixedStepInner advances the world by fixed steps of TickDuration wall time.
+// Real elapsed time is accumulated on every tick of the step ticker and as
+// many steps run as the accumulated time allows, so that the step follows wall
+// time even when updates run long and ticker ticks are dropped. At most
+// MaxCatchUp steps run per tick, dropping any further time, so that a world
+// updating slower than TickDuration does not fall ever further behind; below 1
+// the steps run are not limited. The remaining fraction of a step is available
+// from Alpha and published with OnInterpolate after every tick.
+func FixedStepInner(e *Engine, w core.World) Inner {
+	s := step.New(e.TickDuration, e.TickInit)
+	e.step = s
+	return func() {
+		dt := e.TickDuration
+		var acc time.Duration
+		last := time.Now()
+		for e.run.next(s) {
+			now := time.Now()
+			acc += now.Sub(last)
+			last = now
+			if limit := time.Duration(e.MaxCatchUp) * dt; e.MaxCatchUp > 0 && acc > limit {
+				acc = limit
+			}
+			for acc >= dt {
+				acc -= dt
+				s.Increment(e.TickIncr)
+				switch {
+				case e.lock:
+					acc = 0
+				case e.rw.pending():
+					// a rollback resumes at the last completed step
+					e.rollback(w, s)
+					acc += dt
+				case e.kill:
+					e.signalKill()
+				default:
+					e.tick(w, s)
+				}
+				killIf(e, s)
+			}
+			alpha := float64(acc) / float64(dt)
+			atomic.StoreUint64(&e.alpha, math.Float64bits(alpha))
+			e.Dispatch(OnInterpolate, InterpolateEvent{e, s.Value, alpha})
+		}
+	}
+}
+
+// Alpha returns the fraction of a step of wall time elapsed since the last
+// step run by FixedStepInner, from 0 up to but excluding 1, for interpolating
+// between the previous and current world state when rendering.
+func (e *Engine) Alpha() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&e.alpha))
+}
+
+// tick updates the world for the step and runs tick hooks, publishing
+// OnTick.
+func (e *Engine) tick(w core.World, s *step.Step) {
+	start := time.Now()
+	e.update(w, s)
+	e.execTick(e, s)
+	e.Dispatch(OnTick, TickEvent{e, s.Value, time.Since(start)})
+}
+
 func (e *Engine) DebugReport(f Frame, s *step.Step) {
 	if e.DebugReportStep {
 		e.Printf("step: %f", s.Value)
 	}
-	if e.DebugReportFrame {
-		frameReport(e, f)
-	}
+	frameReport(e, f, s)
 }
 
 func killIf(e *Engine, s *step.Step) {
 	e.LastTick = s.Value
 	if e.TickEnd != 0.0 && s.Value == e.TickEnd {
 		e.lock = true
-		e.ChKill <- struct{}{}
+		e.signalKill()
 	}
 }
 
+// Pause stops world updates, notifying world systems.
+func (e *Engine) Pause() {
+	e.State.Pause()
+	e.World.Pause()
+	e.publish(OnPaused)
+}
+
+// Unpause resumes world updates, notifying world systems.
+func (e *Engine) Unpause() {
+	e.State.Unpause()
+	e.World.Resume()
+	e.publish(OnResumed)
+}
+
 //
 func (e *Engine) Run() {
+	if !e.run.start() {
+		return
+	}
+	defer close(e.run.halted)
 	inr := e.inner
+	if e.rw.recording() {
+		e.World.Mark(e.TickInit)
+	}
 	e.Print("running...")
+	e.publish(OnRunning)
 	inr()
 }
 
@@ -240,9 +461,14 @@ func (e *Engine) SignalHandler(s os.Signal) int {
 	return -1
 }
 
-// Handles closing, returns an exit code only unless settings.HardExit is true
+// Handles closing, returns an exit code only unless settings.HardExit is true.
+// A running engine stops once its current step completes, before any close
+// hook runs and world systems are shut down.
 func (e *Engine) Close() int {
+	e.run.stop()
+	e.publish(OnClosing)
 	e.execClose(e)
+	e.World.Close()
 	var ret int = 0
 	switch {
 	case e.last != nil:
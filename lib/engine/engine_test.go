@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+	"github.com/Laughs-In-Flowers/holo/lib/util/step"
+)
+
+func newEngine(t *testing.T, cnf ...Config) *Engine {
+	t.Helper()
+	e, err := New(cnf...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// counter counts its updates and records updates running after or while it
+// is shut down.
+type counter struct {
+	updating int32
+	updates  int64
+	shut     int32
+	late     int32
+}
+
+func (c *counter) Priority() int { return 0 }
+func (c *counter) Remove(uint64) {}
+func (c *counter) Shutdown(core.World) {
+	if atomic.LoadInt32(&c.updating) != 0 {
+		atomic.StoreInt32(&c.late, 1)
+	}
+	atomic.StoreInt32(&c.shut, 1)
+}
+func (c *counter) Update(*step.Step) error {
+	atomic.StoreInt32(&c.updating, 1)
+	if atomic.LoadInt32(&c.shut) != 0 {
+		atomic.StoreInt32(&c.late, 1)
+	}
+	atomic.AddInt64(&c.updates, 1)
+	time.Sleep(100 * time.Microsecond)
+	atomic.StoreInt32(&c.updating, 0)
+	return nil
+}
+
+func TestCloseWhileRunning(t *testing.T) {
+	e := newEngine(t, SetTickDuration("1ms"))
+	c := &counter{}
+	if err := e.World.Add(c); err != nil {
+		t.Fatal(err)
+	}
+	var clock core.Clock
+	var during int32
+	e.SetClose(func(e *Engine) {
+		clock = e.Clock()
+		during = atomic.LoadInt32(&c.updating)
+	})
+
+	go e.Run()
+	time.Sleep(20 * time.Millisecond)
+	e.Close()
+	updates := atomic.LoadInt64(&c.updates)
+	time.Sleep(10 * time.Millisecond)
+
+	if during != 0 {
+		t.Error("close hook ran during a world update")
+	}
+	if n := atomic.LoadInt64(&c.updates); n != updates {
+		t.Errorf("world updated %d times after closing", n-updates)
+	}
+	if clock.Step != float64(updates) {
+		t.Errorf("closed at step %f after %d updates", clock.Step, updates)
+	}
+}
+
+func TestShutdownAfterLastUpdate(t *testing.T) {
+	e := newEngine(t, SetTickDuration("1ms"))
+	c := &counter{}
+	if err := e.World.Add(c); err != nil {
+		t.Fatal(err)
+	}
+	go e.Run()
+	time.Sleep(20 * time.Millisecond)
+	e.Close()
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&c.shut) == 0 {
+		t.Fatal("system not shut down")
+	}
+	if atomic.LoadInt32(&c.late) != 0 {
+		t.Error("system updated while or after being shut down")
+	}
+}
@@ -28,11 +28,15 @@ func (e *ErrorHandler) SetHandleError(fn HandleErrorFunc) {
 
 func (e *ErrorHandler) HandleError(r error) {
 	e.hefn(e.e, r)
+	if r != nil {
+		e.e.Dispatch(OnError, ErrorEvent{e.e, e.e.Clock().Step, r, false})
+	}
 }
 
 func (e *ErrorHandler) HandleWarning(w ...error) {
 	for _, r := range w {
 		e.warn = append(e.warn, r)
 		e.e.Println(r)
+		e.e.Dispatch(OnError, ErrorEvent{e.e, e.e.Clock().Step, r, true})
 	}
 }
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+)
+
+// The lifecycle events published by an Engine.
+const (
+	OnConfigured  = "engine.configured"
+	OnRunning     = "engine.running"
+	OnPaused      = "engine.paused"
+	OnResumed     = "engine.resumed"
+	OnRestarting  = "engine.restarting"
+	OnTick        = "engine.tick"
+	OnFrame       = "engine.frame"
+	OnInterpolate = "engine.interpolate"
+	OnClosing     = "engine.closing"
+	OnError       = "engine.error"
+)
+
+// EngineEvent is published with OnConfigured, OnRunning, OnPaused, OnResumed,
+// OnRestarting and OnClosing.
+type EngineEvent struct {
+	Engine *Engine
+	Tick   float64
+}
+
+// TickEvent is published with OnTick once the world has been updated and tick
+// hooks run for a step, Elapsed holding the time taken.
+type TickEvent struct {
+	Engine  *Engine
+	Tick    float64
+	Elapsed time.Duration
+}
+
+// FrameEvent is published with OnFrame by the debug inner loop about once a
+// second.
+type FrameEvent struct {
+	Engine       *Engine
+	Tick         float64
+	FPS          float64
+	PotentialFPS float64
+}
+
+// InterpolateEvent is published with OnInterpolate by FixedStepInner after
+// the steps of every tick, Alpha holding the fraction of a step elapsed since.
+type InterpolateEvent struct {
+	Engine *Engine
+	Tick   float64
+	Alpha  float64
+}
+
+// ErrorEvent is published with OnError for every error or warning handled.
+type ErrorEvent struct {
+	Engine  *Engine
+	Tick    float64
+	Err     error
+	Warning bool
+}
+
+// Typed keys of the lifecycle events published by an Engine.
+var (
+	Configured   = core.NewKey[EngineEvent](OnConfigured)
+	Running      = core.NewKey[EngineEvent](OnRunning)
+	Paused       = core.NewKey[EngineEvent](OnPaused)
+	Resumed      = core.NewKey[EngineEvent](OnResumed)
+	Restarting   = core.NewKey[EngineEvent](OnRestarting)
+	Ticked       = core.NewKey[TickEvent](OnTick)
+	Framed       = core.NewKey[FrameEvent](OnFrame)
+	Interpolated = core.NewKey[InterpolateEvent](OnInterpolate)
+	Closing      = core.NewKey[EngineEvent](OnClosing)
+	Errored      = core.NewKey[ErrorEvent](OnError)
+)
+
+// publish dispatches a lifecycle event carrying the current step value.
+func (e *Engine) publish(evname string) {
+	e.Dispatch(evname, EngineEvent{e, e.Clock().Step})
+}
+
+// recoverer returns middleware turning panicking subscribers into warnings
+// rather than letting them unwind through the inner loop. Panics of OnError
+// subscribers are only logged, as warning would publish OnError again.
+func (e *Engine) recoverer() core.Middleware {
+	return core.Recover(func(ev *core.Event, err error) {
+		if ev.Name == OnError {
+			e.Println(err)
+			return
+		}
+		e.HandleWarning(err)
+	})
+}
+
+func UseMiddleware(mw ...core.Middleware) Config {
+	return NewConfig(502,
+		func(e *Engine) error {
+			e.Use(mw...)
+			e.World.Use(mw...)
+			return nil
+		})
+}
+
+func Subscribe(evname string, cb core.Callback) Config {
+	return NewConfig(50,
+		func(e *Engine) error {
+			e.Subscribe(evname, cb)
+			r.Add(fmt.Sprintf("subscribed to %s", evname))
+			return nil
+		})
+}
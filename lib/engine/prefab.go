@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	prefabFileError   = xrr.Xrror("%s: %s").Out
+	prefabDecodeError = xrr.Xrror("cannot decode prefabs: %s").Out
+)
+
+// prefabDecoder defines the prefabs of a file on the world.
+type prefabDecoder func(core.World, []byte) error
+
+var prefabFormats = map[string]prefabDecoder{
+	".json": decodeJSONPrefabs,
+	".yaml": decodeYAMLPrefabs,
+	".yml":  decodeYAMLPrefabs,
+	".toml": decodeTOMLPrefabs,
+}
+
+func decodeJSONPrefabs(w core.World, data []byte) error {
+	return w.LoadPrefabs(bytes.NewReader(data))
+}
+
+func decodeYAMLPrefabs(w core.World, data []byte) error {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return prefabDecodeError(err)
+	}
+	return definePrefabs(w, normalize(raw))
+}
+
+func decodeTOMLPrefabs(w core.World, data []byte) error {
+	var raw map[string]interface{}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return prefabDecodeError(err)
+	}
+	return definePrefabs(w, normalize(raw))
+}
+
+func definePrefabs(w core.World, raw interface{}) error {
+	if raw == nil {
+		return nil
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return prefabDecodeError("prefabs must be a map of names to prefabs")
+	}
+	return w.DefinePrefabs(m)
+}
+
+// normalize converts decoded values to the shape JSON decodes to, turning the
+// map[interface{}]interface{} values yaml produces and the
+// []map[string]interface{} values toml produces into map[string]interface{}
+// and []interface{}.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = normalize(e)
+		}
+		return x
+	case []interface{}:
+		for i, e := range x {
+			x[i] = normalize(e)
+		}
+		return x
+	case []map[string]interface{}:
+		ret := make([]interface{}, len(x))
+		for i, e := range x {
+			ret[i] = normalize(e)
+		}
+		return ret
+	}
+	return v
+}
+
+// LoadPrefabs defines the prefabs of every .json, .yaml, .yml and .toml file
+// in dir, in name order, then checks every prefab defined, returning the number
+// of files read. Other files are ignored.
+func (e *Engine) LoadPrefabs(dir string) (int, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, info := range infos {
+		decode, ok := prefabFormats[strings.ToLower(filepath.Ext(info.Name()))]
+		if info.IsDir() || !ok {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		if err := loadPrefabFile(e.World, path, decode); err != nil {
+			return n, prefabFileError(path, err)
+		}
+		n++
+	}
+	return n, e.World.CheckPrefabs()
+}
+
+func loadPrefabFile(w core.World, path string, decode prefabDecoder) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return decode(w, data)
+}
+
+func LoadPrefabs(dir string) Config {
+	return NewConfig(550,
+		func(e *Engine) error {
+			n, err := e.LoadPrefabs(dir)
+			if err != nil {
+				return err
+			}
+			r.Add(fmt.Sprintf("loaded %d prefabs from %d files in %s", len(e.World.Prefabs()), n, dir))
+			return nil
+		})
+}
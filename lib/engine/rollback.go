@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+	"github.com/Laughs-In-Flowers/holo/lib/util/step"
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
+)
+
+var unrecordedStepError = xrr.Xrror("cannot roll back to step %f: not recorded").Out
+
+// Input is a change to the world from outside of its systems. Inputs are
+// applied before the next world update and, when rolling back is enabled,
+// recorded against that step so they are replayed after a rollback.
+type Input func(core.World)
+
+type input struct {
+	tick float64
+	fn   Input
+}
+
+// rewinder queues inputs and records them along with world state for
+// rolling back.
+type rewinder struct {
+	mu       sync.Mutex
+	capacity int
+	queued   []Input
+	log      []input
+	target   *float64
+}
+
+func newRewinder() *rewinder {
+	return &rewinder{}
+}
+
+func (r *rewinder) recording() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.capacity > 0
+}
+
+// take returns the queued inputs to apply for the step, recording them when
+// rolling back is enabled.
+func (r *rewinder) take(s *step.Step) []Input {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queued := r.queued
+	r.queued = nil
+	if r.capacity > 0 {
+		for _, fn := range queued {
+			r.log = append(r.log, input{s.Value, fn})
+		}
+	}
+	return queued
+}
+
+// mark records the world state at the end of the step and drops inputs of
+// steps too old to be rolled back to.
+func (r *rewinder) mark(w core.World, s *step.Step, incr float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.capacity < 1 {
+		return
+	}
+	w.Mark(s.Value)
+	oldest := s.Value - float64(r.capacity)*incr
+	i := 0
+	for i < len(r.log) && r.log[i].tick <= oldest {
+		i++
+	}
+	r.log = r.log[i:]
+}
+
+func (r *rewinder) pending() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.target != nil
+}
+
+func (r *rewinder) reset() {
+	r.mu.Lock()
+	r.log = nil
+	r.target = nil
+	r.mu.Unlock()
+}
+
+// replay returns the recorded inputs of the step.
+func (r *rewinder) replay(tick float64) []Input {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ret []Input
+	for _, in := range r.log {
+		if in.tick == tick {
+			ret = append(ret, in.fn)
+		}
+	}
+	return ret
+}
+
+// Input queues fn to be applied to the world before the next world update.
+func (e *Engine) Input(fn Input) {
+	e.rw.mu.Lock()
+	e.rw.queued = append(e.rw.queued, fn)
+	e.rw.mu.Unlock()
+}
+
+// Rollback requests rewinding the world to its state at the end of the
+// provided step and re-simulating up to the present, replaying the inputs
+// recorded for every step along the way. The rollback takes place between two
+// steps of the running engine.
+func (e *Engine) Rollback(tick float64) error {
+	if !e.World.Recorded(tick) {
+		return unrecordedStepError(tick)
+	}
+	e.rw.mu.Lock()
+	e.rw.target = &tick
+	e.rw.mu.Unlock()
+	return nil
+}
+
+// update applies queued inputs and updates the world for the step.
+func (e *Engine) update(w core.World, s *step.Step) {
+	e.advance(w, s, e.rw.take(s))
+}
+
+// advance applies the inputs and updates the world for the step, recording
+// the resulting state when rolling back is enabled, and flushes queued world
+// events at the configured point. Steps replayed after a rollback advance the
+// same way.
+func (e *Engine) advance(w core.World, s *step.Step, inputs []Input) {
+	if e.EventFlush == FlushBeforeUpdate {
+		w.Flush()
+	}
+	for _, fn := range inputs {
+		fn(w)
+	}
+	w.Update(s)
+	e.rw.mark(w, s, e.TickIncr)
+	if e.EventFlush == FlushAfterUpdate {
+		w.Flush()
+	}
+}
+
+// rollback performs a requested rollback, leaving the step at the last step
+// completed before the rollback.
+func (e *Engine) rollback(w core.World, s *step.Step) {
+	e.rw.mu.Lock()
+	target := *e.rw.target
+	e.rw.target = nil
+	e.rw.mu.Unlock()
+
+	present := e.LastTick
+	if err := w.Rewind(target); err != nil {
+		s.Value = present
+		e.HandleWarning(err)
+		return
+	}
+	s.Value = target
+	for s.Value < present {
+		s.Increment(e.TickIncr)
+		e.advance(w, s, e.rw.replay(s.Value))
+	}
+	if e.DebugReportStep {
+		e.Printf("rolled back to step %f, replayed to %f", target, s.Value)
+	}
+}
+
+// restarted rewinds the world to its recorded initial state when the debug
+// inner restarts, or drops every recorded step when the initial state is no
+// longer recorded.
+func (e *Engine) restarted(w core.World) {
+	e.rw.reset()
+	if !e.rw.recording() {
+		return
+	}
+	if err := w.Rewind(e.TickInit); err != nil {
+		w.Record(0)
+		w.Record(e.rw.capacity)
+		w.Mark(e.TickInit)
+		e.Print("initial world state no longer recorded, restarting from the current world")
+	}
+}
+
+func SetRollback(capacity int) Config {
+	return NewConfig(503,
+		func(e *Engine) error {
+			e.rw.capacity = capacity
+			e.World.Record(capacity)
+			r.Add(fmt.Sprintf("recording %d steps for rollback", capacity))
+			return nil
+		})
+}
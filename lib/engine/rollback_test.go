@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+	"github.com/Laughs-In-Flowers/holo/lib/util/step"
+)
+
+type position struct{ X int }
+
+type velocity struct{ X int }
+
+// mover adds the velocity of every moving entity to its position.
+type mover struct{ w core.World }
+
+func (m *mover) Priority() int       { return 0 }
+func (m *mover) Remove(uint64)       {}
+func (m *mover) Shutdown(core.World) {}
+func (m *mover) Update(*step.Step) error {
+	m.w.Query().With(position{}, velocity{}).Each(func(ent core.Entity) {
+		p, _ := m.w.Component(ent, position{})
+		v, _ := m.w.Component(ent, velocity{})
+		m.w.Attach(ent, position{p.(position).X + v.(velocity).X})
+	})
+	return nil
+}
+
+func positions(w core.World) []int {
+	var ret []int
+	for _, ent := range w.Query().With(position{}).Entities() {
+		p, _ := w.Component(ent, position{})
+		ret = append(ret, p.(position).X)
+	}
+	return ret
+}
+
+func TestRollbackReplaysInputs(t *testing.T) {
+	e := newEngine(t, SetRollback(16))
+	if err := e.World.Add(&mover{e.World}); err != nil {
+		t.Fatal(err)
+	}
+	var spawned core.Entity
+	inputs := map[int]Input{
+		3: func(w core.World) {
+			spawned = w.NewEntity()
+			w.Attach(spawned, position{0}, velocity{1})
+		},
+		6: func(w core.World) { w.Attach(spawned, velocity{3}) },
+	}
+	s := step.New(time.Hour, e.TickInit)
+	defer s.Stop()
+	for i := 1; i <= 8; i++ {
+		if in, ok := inputs[i]; ok {
+			e.Input(in)
+		}
+		s.Increment(e.TickIncr)
+		e.update(e.World, s)
+		e.LastTick = s.Value
+	}
+	want := positions(e.World)
+	if !reflect.DeepEqual(want, []int{12}) {
+		t.Fatalf("positions %v before rolling back, expected [12]", want)
+	}
+
+	if err := e.Rollback(2); err != nil {
+		t.Fatal(err)
+	}
+	e.rollback(e.World, s)
+	if s.Value != 8 {
+		t.Errorf("rolled back to step %f, expected 8", s.Value)
+	}
+	if got := positions(e.World); !reflect.DeepEqual(got, want) {
+		t.Errorf("positions %v after rolling back, expected %v", got, want)
+	}
+	if n := e.World.Len(); n != 1 {
+		t.Errorf("%d entities after rolling back, expected 1", n)
+	}
+	if err := e.Rollback(100); err == nil {
+		t.Error("rolled back to an unrecorded step")
+	}
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+)
+
+// Clock returns the current step value and last tick of the engine.
+func (e *Engine) Clock() core.Clock {
+	c := core.Clock{Step: e.TickInit, LastTick: e.LastTick}
+	if e.step != nil {
+		c.Step = e.step.Value
+	}
+	return c
+}
+
+// Save writes a snapshot of the world and engine clock to the provided path.
+func (e *Engine) Save(path string, enc core.Encoding) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err = e.World.Save(bw, enc, e.Clock()); err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Load replaces the world with the snapshot at the provided path, resuming
+// the engine clock from the saved step value.
+func (e *Engine) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return e.load(f)
+}
+
+func (e *Engine) load(rd io.Reader) error {
+	c, err := e.World.Load(rd)
+	if err != nil {
+		return err
+	}
+	e.TickInit = c.Step
+	e.LastTick = c.LastTick
+	if e.step != nil {
+		e.step.Value = c.Step
+	}
+	return nil
+}
+
+func RegisterType(name string, v interface{}) Config {
+	return NewConfig(502,
+		func(e *Engine) error {
+			return e.World.Register(name, v)
+		})
+}
+
+func LoadSnapshot(path string) Config {
+	return NewConfig(550,
+		func(e *Engine) error {
+			if err := e.Load(path); err != nil {
+				return err
+			}
+			r.Add(fmt.Sprintf("loaded snapshot %s at step %f", path, e.TickInit))
+			return nil
+		})
+}
+
+func SaveSnapshot(path string, enc core.Encoding) Config {
+	return NewConfig(550,
+		func(e *Engine) error {
+			e.SetClose(func(e *Engine) {
+				if err := e.Save(path, enc); err != nil {
+					e.HandleWarning(err)
+					return
+				}
+				e.Printf("saved snapshot %s", path)
+			})
+			return nil
+		})
+}
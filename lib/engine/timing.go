@@ -2,6 +2,9 @@ package engine
 
 import (
 	"time"
+
+	"github.com/Laughs-In-Flowers/holo/lib/core"
+	"github.com/Laughs-In-Flowers/holo/lib/util/step"
 )
 
 type FrameFunc func(*frame)
@@ -112,8 +115,30 @@ func (f *frame) FPS(t time.Duration) (float64, float64, bool) {
 	return f.fps(f, t)
 }
 
-func frameReport(e *Engine, f Frame) {
+func frameReport(e *Engine, f Frame, s *step.Step) {
 	if fps, pfps, b := f.FPS(1 * time.Second); b {
-		e.Printf("fps: %f / pfps: %f", fps, pfps)
+		if e.DebugReportFrame {
+			e.Printf("fps: %f / pfps: %f", fps, pfps)
+		}
+		e.Dispatch(OnFrame, FrameEvent{e, s.Value, fps, pfps})
+	}
+}
+
+// FrameCadence returns a stage cadence running the stage at most target times
+// per second of wall time, independent of the tick rate, e.g. for a render
+// stage. A target of 0 defaults to 60.
+func FrameCadence(target uint) core.Cadence {
+	if target < 1 {
+		target = 60
+	}
+	d := time.Second / time.Duration(target)
+	var last time.Time
+	return func(*step.Step) bool {
+		now := time.Now()
+		if now.Sub(last) < d {
+			return false
+		}
+		last = now
+		return true
 	}
 }
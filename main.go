@@ -4,9 +4,12 @@ import (
 	"context"
 	"os"
 	"path"
+	"time"
 
 	"github.com/Laughs-In-Flowers/flip"
+	"github.com/Laughs-In-Flowers/holo/lib/core"
 	"github.com/Laughs-In-Flowers/holo/lib/engine"
+	"github.com/Laughs-In-Flowers/holo/lib/util/xrr"
 	"github.com/Laughs-In-Flowers/log"
 )
 
@@ -154,6 +157,9 @@ func engineInit(o *Options, c context.Context) (context.Context, flip.ExitStatus
 	switch {
 	case O.debug:
 		inr = engine.DebugInner
+	case O.fixedStep:
+		inr = engine.FixedStepInner
+		eiz = append(eiz, engine.SetMaxCatchUp(O.maxCatchUp))
 	case O.noTickDuration:
 		inr = engine.NoDurationLimitInner
 	}
@@ -165,6 +171,65 @@ func engineInit(o *Options, c context.Context) (context.Context, flip.ExitStatus
 		engine.SetLastTick(O.lastTick),
 	)
 
+	if O.workers > 0 {
+		eiz = append(eiz, engine.SetWorkers(O.workers))
+	}
+
+	if O.renderFPS > 0 {
+		eiz = append(eiz, engine.SetStageCadence(core.StageRender, engine.FrameCadence(uint(O.renderFPS))))
+	}
+
+	if O.snapshot != "" {
+		eiz = append(eiz, engine.LoadSnapshot(O.snapshot))
+	}
+
+	if O.saveSnapshot != "" {
+		enc, err := snapshotEncoding(O.snapshotFormat)
+		if err != nil {
+			O.Print(err)
+			return c, flip.ExitUsageError
+		}
+		eiz = append(eiz, engine.SaveSnapshot(O.saveSnapshot, enc))
+	}
+
+	if O.resume && O.checkpointDir == "" {
+		O.Print(resumeWithoutDirError())
+		return c, flip.ExitUsageError
+	}
+
+	if O.checkpointDir != "" {
+		enc, err := snapshotEncoding(O.snapshotFormat)
+		if err != nil {
+			O.Print(err)
+			return c, flip.ExitUsageError
+		}
+		interval, err := time.ParseDuration(O.checkpointInterval)
+		if err != nil {
+			O.Print(err)
+			return c, flip.ExitUsageError
+		}
+		if O.resume {
+			eiz = append(eiz, engine.ResumeCheckpoint(O.checkpointDir))
+		}
+		if O.checkpointTicks > 0 || interval > 0 {
+			eiz = append(eiz, engine.SetCheckpoint(engine.CheckpointPolicy{
+				Dir:      O.checkpointDir,
+				Ticks:    O.checkpointTicks,
+				Interval: interval,
+				Keep:     O.checkpointKeep,
+				Encoding: enc,
+			}))
+		}
+	}
+
+	if O.prefabs != "" {
+		eiz = append(eiz, engine.LoadPrefabs(O.prefabs))
+	}
+
+	if O.rollback > 0 {
+		eiz = append(eiz, engine.SetRollback(O.rollback))
+	}
+
 	E, engineInitError = engine.New(eiz...)
 
 	if engineInitError != nil {
@@ -175,6 +240,21 @@ func engineInit(o *Options, c context.Context) (context.Context, flip.ExitStatus
 	return c, flip.ExitNo
 }
 
+var (
+	unknownFormatError    = xrr.Xrror("unknown snapshot format %s").Out
+	resumeWithoutDirError = xrr.Xrror("-resume requires -checkpointDir").Out
+)
+
+func snapshotEncoding(f string) (core.Encoding, error) {
+	switch f {
+	case "binary":
+		return core.Binary, nil
+	case "json":
+		return core.JSON, nil
+	}
+	return core.Binary, unknownFormatError(f)
+}
+
 func retSignal(out int) flip.ExitStatus {
 	switch out {
 	case 0:
@@ -212,6 +292,20 @@ func rFlags(fs *flip.FlagSet, o *Options) *flip.FlagSet {
 	fs.StringVar(&o.tickDuration, "tickDuration", o.tickDuration, "The duration between world processing steps.")
 	fs.Float64Var(&o.tickValue, "tickValue", o.tickValue, "The tick value to increment by on world processing steps.")
 	fs.Float64Var(&o.lastTick, "lastTick", o.lastTick, "Stop engine running when this tick value is reached.")
+	fs.IntVar(&o.workers, "workers", o.workers, "The number of goroutines running non-conflicting systems concurrently, 1 runs systems serially. Defaults to GOMAXPROCS.")
+	fs.IntVar(&o.renderFPS, "renderFPS", o.renderFPS, "Run the render stage at most this many times per second, 0 runs it every step.")
+	fs.StringVar(&o.snapshot, "snapshot", o.snapshot, "Start from the world snapshot at this path.")
+	fs.StringVar(&o.saveSnapshot, "saveSnapshot", o.saveSnapshot, "Save a world snapshot to this path when closing.")
+	fs.StringVar(&o.snapshotFormat, "snapshotFormat", o.snapshotFormat, "The format of saved snapshots and checkpoints. [binary|json]")
+	fs.StringVar(&o.checkpointDir, "checkpointDir", o.checkpointDir, "The directory checkpoints are written to and resumed from.")
+	fs.IntVar(&o.checkpointTicks, "checkpointTicks", o.checkpointTicks, "Write a checkpoint every this many ticks, 0 disables.")
+	fs.StringVar(&o.checkpointInterval, "checkpointInterval", o.checkpointInterval, "Write a checkpoint every this duration of wall time, 0 disables.")
+	fs.IntVar(&o.checkpointKeep, "checkpointKeep", o.checkpointKeep, "The number of checkpoints to keep.")
+	fs.BoolVar(&o.resume, "resume", o.resume, "Resume from the newest valid checkpoint in checkpointDir.")
+	fs.StringVar(&o.prefabs, "prefabs", o.prefabs, "Load the prefab files of this directory, failing on any malformed prefab.")
+	fs.IntVar(&o.rollback, "rollback", o.rollback, "Record this many steps of world state for rolling back, 0 disables.")
+	fs.BoolVar(&o.fixedStep, "fixedStep", o.fixedStep, "Run steps of tickDuration at the pace of wall time, catching up after long updates, does not override debug.")
+	fs.IntVar(&o.maxCatchUp, "maxCatchUp", o.maxCatchUp, "The most steps fixedStep runs at once to catch up with wall time, 0 does not limit.")
 	return fs
 }
 
@@ -219,10 +313,23 @@ type rOptions struct {
 	noTickDuration      bool
 	tickDuration        string
 	tickValue, lastTick float64
+	workers, renderFPS  int
+	snapshot            string
+	saveSnapshot        string
+	snapshotFormat      string
+	checkpointDir       string
+	checkpointTicks     int
+	checkpointInterval  string
+	checkpointKeep      int
+	resume              bool
+	rollback            int
+	prefabs             string
+	fixedStep           bool
+	maxCatchUp          int
 }
 
 func defaultROptions() *rOptions {
-	return &rOptions{false, "1ns", 1.0, 0.0}
+	return &rOptions{false, "1ns", 1.0, 0.0, 0, 0, "", "", "binary", "", 0, "0", 3, false, 0, "", false, 5}
 }
 
 func RunCommand() flip.Command {